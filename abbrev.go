@@ -0,0 +1,408 @@
+// File: abbrev.go
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EnableAbbreviations 把常见基团缩写成标签（Me、Ph、Boc…），main 中可用 CHIRAL_ABBREV=0 关闭
+var EnableAbbreviations = true
+
+// AbbreviateMinAtoms 重原子数达到该值的分子才缩写，小分子保持完整骨架
+var AbbreviateMinAtoms = 25
+
+// groupAbbrev 一个可识别的基团。Pattern 为简化 SMILES，以 * 表示连接点，
+// 只支持链状结构、分支 ()、=/# 键和 [N+] 这类带电荷的方括号原子
+type groupAbbrev struct {
+	Pattern    string
+	Label      string // 键从左侧连入时的写法
+	LeftLabel  string // 键从右侧连入时的写法（MeO、HOOC…），空表示同 Label
+	HeteroOnly bool   // 只在连到杂原子上时缩写（N-Me、O-Et），碳链上的甲基、乙基照常画线
+	canon      string
+}
+
+// groupAbbrevs 按模式匹配的基团；苯基是环，单独用 isPhenylBranch 识别
+var groupAbbrevs = []groupAbbrev{
+	{Pattern: "*C", Label: "Me", HeteroOnly: true},
+	{Pattern: "*CC", Label: "Et", HeteroOnly: true},
+	{Pattern: "*C(C)C", Label: "iPr"},
+	{Pattern: "*C(C)(C)C", Label: "tBu"},
+	{Pattern: "*OC", Label: "OMe", LeftLabel: "MeO"},
+	{Pattern: "*OCC", Label: "OEt", LeftLabel: "EtO"},
+	{Pattern: "*C(F)(F)F", Label: "CF3", LeftLabel: "F3C"},
+	{Pattern: "*C(=O)O", Label: "COOH", LeftLabel: "HOOC"},
+	{Pattern: "*C(=O)OC", Label: "CO2Me", LeftLabel: "MeO2C"},
+	{Pattern: "*C(=O)OCC", Label: "CO2Et", LeftLabel: "EtO2C"},
+	{Pattern: "*C(=O)C", Label: "Ac"},
+	{Pattern: "*OC(=O)C", Label: "OAc", LeftLabel: "AcO"},
+	{Pattern: "*C#N", Label: "CN", LeftLabel: "NC"},
+	{Pattern: "*[N+](=O)[O-]", Label: "NO2", LeftLabel: "O2N"},
+	{Pattern: "*C(=O)OC(C)(C)C", Label: "Boc"},
+	{Pattern: "*[Si](C)(C)C", Label: "TMS"},
+	{Pattern: "*O[Si](C)(C)C", Label: "OTMS", LeftLabel: "TMSO"},
+}
+
+const phenylLabel = "Ph"
+
+// maxGroupAtoms 候选基团的原子数上限（含显式氢），超过的分支不可能匹配任何缩写
+const maxGroupAtoms = 40
+
+// GroupLabelText 标签原子的显示文字：键从右侧连入（left 为 true）时用 MeO、HOOC 这类反写形式。
+// 缩写表里的标签按表中写法，其余的（CH2OH、CHO 等缩合式）按元素逐段反写
+func GroupLabelText(label string, left bool) string {
+	if !left {
+		return label
+	}
+	for _, g := range groupAbbrevs {
+		if g.Label == label {
+			if g.LeftLabel != "" {
+				return g.LeftLabel
+			}
+			return label
+		}
+	}
+	return reverseCondensed(label)
+}
+
+// reverseCondensed 把缩合式按"元素符号+个数"逐段倒序：CH2OH → HOH2C，CHO → OHC
+func reverseCondensed(s string) string {
+	var parts []string
+	for i := 0; i < len(s); {
+		j := i + 1
+		for j < len(s) && (s[j] >= 'a' && s[j] <= 'z' || s[j] >= '0' && s[j] <= '9') {
+			j++
+		}
+		parts = append(parts, s[i:j])
+		i = j
+	}
+	for a, b := 0, len(parts)-1; a < b; a, b = a+1, b-1 {
+		parts[a], parts[b] = parts[b], parts[a]
+	}
+	return strings.Join(parts, "")
+}
+
+// abbrevByCanon 规范字符串 → 基团，init 中建立
+var abbrevByCanon = make(map[string]*groupAbbrev)
+
+func init() {
+	for i := range groupAbbrevs {
+		g := &groupAbbrevs[i]
+		pm, err := parseGroupPattern(g.Pattern)
+		if err != nil {
+			panic(err)
+		}
+		Hydrogenate(pm)
+		g.canon = pm.branchCanon(1, 0)
+		abbrevByCanon[g.canon] = g
+	}
+}
+
+// parseGroupPattern 把简化 SMILES 解析成分子：原子 0 为连接点 *，原子 1 为基团根原子
+func parseGroupPattern(s string) (*Molecule, error) {
+	m := &Molecule{}
+	var stack []int
+	prev, order := -1, 1
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '(':
+			stack = append(stack, prev)
+			i++
+			continue
+		case c == ')':
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("group pattern %q: unbalanced ')'", s)
+			}
+			prev = stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			i++
+			continue
+		case c == '=':
+			order = 2
+			i++
+			continue
+		case c == '#':
+			order = 3
+			i++
+			continue
+		}
+		var a Atom
+		switch {
+		case c == '*':
+			a.Element = "*"
+			i++
+		case c == '[':
+			end := strings.IndexByte(s[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("group pattern %q: unterminated '['", s)
+			}
+			body := s[i+1 : i+end]
+			switch {
+			case strings.HasSuffix(body, "+"):
+				a.Charge, body = 1, body[:len(body)-1]
+			case strings.HasSuffix(body, "-"):
+				a.Charge, body = -1, body[:len(body)-1]
+			}
+			a.Element = body
+			i += end + 1
+		case c >= 'A' && c <= 'Z':
+			n := 1
+			if i+1 < len(s) && s[i+1] >= 'a' && s[i+1] <= 'z' {
+				n = 2
+			}
+			a.Element = s[i : i+n]
+			i += n
+		default:
+			return nil, fmt.Errorf("group pattern %q: unexpected %q", s, c)
+		}
+		idx := m.AddAtom(a)
+		if prev >= 0 {
+			if _, err := m.AddBond(prev, idx, order); err != nil {
+				return nil, err
+			}
+		}
+		prev, order = idx, 1
+	}
+	return m, nil
+}
+
+// branchCanon 以 a 为根、parent 为来向的链状基团的规范字符串；显式氢并入氢计数。
+// 子基团按字符串排序，因此与原子顺序无关
+func (m *Molecule) branchCanon(a, parent int) string {
+	m.buildCaches()
+	at := &m.Atoms[a]
+	h := at.HCount
+	var kids []string
+	for _, bid := range m.atomBondMap[a] {
+		b := m.Bonds[bid-1]
+		other := b.From
+		if other == a {
+			other = b.To
+		}
+		if other == parent {
+			continue
+		}
+		if o := &m.Atoms[other]; o.Element == "H" && o.Isotope == 0 && o.Charge == 0 {
+			h++
+			continue
+		}
+		kids = append(kids, strconv.Itoa(b.Order)+m.branchCanon(other, a))
+	}
+	sort.Strings(kids)
+	return fmt.Sprintf("%s%d%+dH%d(%s)", at.Element, at.Isotope, at.Charge, h, strings.Join(kids, ","))
+}
+
+// branchAtoms 从 root 出发、不经过 via 能到达的原子（0-based），即键 via–root 在 root 一侧的部分
+func (m *Molecule) branchAtoms(root, via int) []int {
+	m.buildCaches()
+	seen := map[int]bool{root: true, via: true}
+	out := []int{root}
+	for k := 0; k < len(out); k++ {
+		for _, bid := range m.atomBondMap[out[k]] {
+			b := m.Bonds[bid-1]
+			for _, o := range []int{b.From, b.To} {
+				if !seen[o] {
+					seen[o] = true
+					out = append(out, o)
+				}
+			}
+		}
+	}
+	return out
+}
+
+// isPhenylBranch 分支是否恰为一个 C6H5：六个碳成环、root 为连接点、其余五个碳各带一个氢，
+// 芳香键（4）或三根双键的 Kekulé 写法均可
+func (m *Molecule) isPhenylBranch(branch []int, root int, bondRing []int) bool {
+	var carbons []int
+	in := make(map[int]bool, len(branch))
+	for _, a := range branch {
+		switch e := m.Atoms[a].Element; {
+		case e == "C":
+			carbons = append(carbons, a)
+			in[a] = true
+		case e == "H" && m.Atoms[a].Isotope == 0:
+		default:
+			return false
+		}
+	}
+	if len(carbons) != 6 {
+		return false
+	}
+	doubles, aromatic := 0, 0
+	for bi, b := range m.Bonds {
+		if !in[b.From] || !in[b.To] {
+			continue
+		}
+		if bondRing[bi] < 0 {
+			return false
+		}
+		switch b.Order {
+		case 2:
+			doubles++
+		case 4:
+			aromatic++
+		}
+	}
+	if doubles != 3 && aromatic != 6 {
+		return false
+	}
+	for _, c := range carbons {
+		a := &m.Atoms[c]
+		if a.Charge != 0 || a.Isotope != 0 {
+			return false
+		}
+		h := a.HCount
+		for _, bid := range m.atomBondMap[c] {
+			b := m.Bonds[bid-1]
+			if o := b.From + b.To - c; m.Atoms[o].Element == "H" {
+				h++
+			}
+		}
+		if c != root && h != 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// ringAtomSet 在环上的原子（0-based），bondRing 来自 BondRings
+func (m *Molecule) ringAtomSet(bondRing []int) map[int]bool {
+	ring := make(map[int]bool)
+	for bi, b := range m.Bonds {
+		if bondRing[bi] >= 0 {
+			ring[b.From], ring[b.To] = true, true
+		}
+	}
+	return ring
+}
+
+// abbrevLabel 分支 atoms（root 一侧，经 via 连到分子其余部分）对应的缩写，不认识时返回空字符串
+func (m *Molecule) abbrevLabel(atoms []int, root, via int, bondRing []int, ringAtoms map[int]bool) string {
+	if m.isPhenylBranch(atoms, root, bondRing) {
+		return phenylLabel
+	}
+	if containsAny(atoms, ringAtoms) {
+		return "" // branchCanon 只处理链状基团
+	}
+	g := abbrevByCanon[m.branchCanon(root, via)]
+	if g == nil || (g.HeteroOnly && m.Atoms[via].Element == "C") {
+		return ""
+	}
+	return g.Label
+}
+
+// abbrevCandidate 一个可折叠的基团：root 为基团根原子，via 为分子其余部分上与之相连的原子
+type abbrevCandidate struct {
+	root, via int
+	atoms     []int
+	label     string
+}
+
+// Abbreviate 返回把可识别基团折叠成标签原子后的分子拷贝，以及旧原子下标（0-based）到新下标的映射，
+// 被折叠掉的原子映射为 -1。keep 中的原子（1-based，通常是答案）所在的基团不折叠。
+// 只考虑非环单键，多个候选重叠时保留较大的基团
+func Abbreviate(mol *Molecule, keep []int) (*Molecule, []int) {
+	remap := make([]int, len(mol.Atoms))
+	for i := range remap {
+		remap[i] = i
+	}
+	heavy := 0
+	for _, a := range mol.Atoms {
+		if a.Element != "H" {
+			heavy++
+		}
+	}
+	if heavy < AbbreviateMinAtoms {
+		return mol, remap
+	}
+	keepSet := make(map[int]bool, len(keep))
+	for _, idx := range keep {
+		keepSet[idx-1] = true
+	}
+
+	_, bondRing := mol.BondRings()
+	ringAtoms := mol.ringAtomSet(bondRing)
+	var cands []abbrevCandidate
+	for bi, b := range mol.Bonds {
+		if b.Order != 1 || bondRing[bi] >= 0 {
+			continue
+		}
+		for _, dir := range [][2]int{{b.From, b.To}, {b.To, b.From}} {
+			root, via := dir[0], dir[1]
+			if mol.Atoms[root].Element == "H" {
+				continue
+			}
+			atoms := mol.branchAtoms(root, via)
+			if len(atoms) > maxGroupAtoms || containsAny(atoms, keepSet) {
+				continue
+			}
+			if label := mol.abbrevLabel(atoms, root, via, bondRing, ringAtoms); label != "" {
+				cands = append(cands, abbrevCandidate{root: root, via: via, atoms: atoms, label: label})
+			}
+		}
+	}
+	if len(cands) == 0 {
+		return mol, remap
+	}
+	sort.SliceStable(cands, func(i, j int) bool { return len(cands[i].atoms) > len(cands[j].atoms) })
+
+	// 从大到小接受互不重叠的基团；via 必须留在分子里
+	used := make(map[int]bool)
+	labels := make(map[int]string)
+	for _, c := range cands {
+		if used[c.via] || containsAny(c.atoms, used) {
+			continue
+		}
+		for _, a := range c.atoms {
+			used[a] = true
+		}
+		labels[c.root] = c.label
+	}
+
+	out := &Molecule{IgnoreIsotopes: mol.IgnoreIsotopes}
+	for i, a := range mol.Atoms {
+		label, isRoot := labels[i]
+		if used[i] && !isRoot {
+			remap[i] = -1
+			continue
+		}
+		if isRoot {
+			a.Label = label
+			a.HCount, a.Charge, a.Isotope = 0, 0, 0
+		}
+		remap[i] = out.AddAtom(a)
+	}
+	// 基团内部的原子都已删除，根原子只剩连向 via 的键
+	for _, b := range mol.Bonds {
+		if remap[b.From] < 0 || remap[b.To] < 0 {
+			continue
+		}
+		b.From, b.To = remap[b.From], remap[b.To]
+		out.Bonds = append(out.Bonds, b)
+	}
+	return out, remap
+}
+
+// RemapAtoms 按 Abbreviate 的映射换算 1-based 原子下标，被折叠的原子丢弃
+func RemapAtoms(idx []int, remap []int) []int {
+	out := make([]int, 0, len(idx))
+	for _, i := range idx {
+		if n := remap[i-1]; n >= 0 {
+			out = append(out, n+1)
+		}
+	}
+	return out
+}
+
+func containsAny(atoms []int, set map[int]bool) bool {
+	for _, a := range atoms {
+		if set[a] {
+			return true
+		}
+	}
+	return false
+}
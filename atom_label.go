@@ -0,0 +1,228 @@
+// File: atom_label.go
+package main
+
+import (
+	"math"
+	"strconv"
+)
+
+// 上下标字号相对 cfg.FontSize 的比例，以及相对基线的偏移比例
+const (
+	labelScriptScale  = 0.7
+	labelSubscriptDy  = 0.3
+	labelSuperscripDy = 0.45
+)
+
+// foldedHydrogens 标记可并入杂原子标签的显式氢（如 O–H 画成 "OH"）：
+// 无同位素、无电荷、只连着一个非碳、非氢原子的 H。被并入的氢及其键不再单独绘制
+func foldedHydrogens(mol *Molecule) []bool {
+	mol.buildCaches()
+	hidden := make([]bool, len(mol.Atoms))
+	for i, a := range mol.Atoms {
+		if a.Element != "H" || a.Isotope != 0 || a.Charge != 0 || len(mol.atomBondMap[i]) != 1 {
+			continue
+		}
+		b := mol.Bonds[mol.atomBondMap[i][0]-1]
+		other := b.From
+		if other == i {
+			other = b.To
+		}
+		if e := mol.Atoms[other].Element; e != "C" && e != "H" {
+			hidden[i] = true
+		}
+	}
+	return hidden
+}
+
+// labelHydrogens 标签上显示的氢数：隐式氢 + 被并入的显式氢
+func labelHydrogens(mol *Molecule, hidden []bool, i int) int {
+	n := mol.Atoms[i].HCount
+	for _, bid := range mol.atomBondMap[i] {
+		b := mol.Bonds[bid-1]
+		other := b.From
+		if other == i {
+			other = b.To
+		}
+		if hidden[other] {
+			n++
+		}
+	}
+	return n
+}
+
+// hydrogensOnLeft 键主要朝右时把氢写在左边（H2N–、HO–）；孤立的 O/S/卤素写成 H2O、HCl
+func hydrogensOnLeft(mol *Molecule, hidden []bool, i int) bool {
+	a := mol.Atoms[i]
+	dx := 0.0
+	visible := 0
+	for _, bid := range mol.atomBondMap[i] {
+		b := mol.Bonds[bid-1]
+		other := b.From
+		if other == i {
+			other = b.To
+		}
+		if hidden[other] {
+			continue
+		}
+		dx += mol.Atoms[other].X - a.X
+		visible++
+	}
+	if visible == 0 {
+		switch a.Element {
+		case "O", "S", "Se", "F", "Cl", "Br", "I":
+			return true
+		}
+		return false
+	}
+	return dx > 1e-6
+}
+
+// chargeText 形式电荷上标文字：+、2+、−、3− …
+func chargeText(c int) string {
+	if c == 0 {
+		return ""
+	}
+	sign := "+"
+	if c < 0 {
+		sign = "−"
+	}
+	if n := abs(c); n > 1 {
+		return strconv.Itoa(n) + sign
+	}
+	return sign
+}
+
+// drawAtomLabel 以 (x, y) 为元素符号中心绘制完整原子标签：
+// 同位素上标前缀、元素符号、氢及下标个数（左或右）、电荷上标，
+// 并把标签包围盒写回 cfg.LabelLeft/Right/Top/Bottom 供 calcLinePointConfined 截断键线
+func drawAtomLabel(dc Renderer, cfg *MoleculeRenderConfig, a Atom, i int, x, y float64, hcount int, hLeft bool) {
+	fs := cfg.FontSize
+	small := fs * labelScriptScale
+
+	dc.SetFont(cfg.FontFamily, fs)
+	ew, _ := dc.MeasureString(a.Element)
+	dc.DrawStringAnchored(a.Element, x, y, 0.5, 0.5)
+	base := y + dc.FontHeight()/2 // DrawStringAnchored 的基线位置
+	left, right := ew/2, ew/2
+	top, bottom := fs/2, fs/2
+
+	// 同位素前缀紧贴元素符号左上
+	if a.Isotope != 0 {
+		s := strconv.Itoa(a.Isotope)
+		dc.SetFont(cfg.FontFamily, small)
+		w, _ := dc.MeasureString(s)
+		left += w
+		dc.DrawString(s, x-left, base-fs*labelSuperscripDy)
+		top = math.Max(top, fs/2+small*labelSuperscripDy)
+	}
+
+	// 氢及下标
+	if hcount > 0 {
+		dc.SetFont(cfg.FontFamily, fs)
+		hw, _ := dc.MeasureString("H")
+		cnt := ""
+		cw := 0.0
+		if hcount > 1 {
+			cnt = strconv.Itoa(hcount)
+			dc.SetFont(cfg.FontFamily, small)
+			cw, _ = dc.MeasureString(cnt)
+		}
+		hx := x + right
+		if hLeft {
+			left += hw + cw
+			hx = x - left
+		} else {
+			right += hw + cw
+		}
+		dc.SetFont(cfg.FontFamily, fs)
+		dc.DrawString("H", hx, base)
+		if cnt != "" {
+			dc.SetFont(cfg.FontFamily, small)
+			dc.DrawString(cnt, hx+hw, base+small*labelSubscriptDy)
+			bottom = math.Max(bottom, fs/2+small*labelSubscriptDy)
+		}
+	}
+
+	// 电荷上标放在最右侧
+	if s := chargeText(a.Charge); s != "" {
+		dc.SetFont(cfg.FontFamily, small)
+		w, _ := dc.MeasureString(s)
+		dc.DrawString(s, x+right, base-fs*labelSuperscripDy)
+		right += w
+		top = math.Max(top, fs/2+small*labelSuperscripDy)
+	}
+
+	dc.SetFont(cfg.FontFamily, fs)
+	cfg.LabelLeft[i] = left
+	cfg.LabelRight[i] = right
+	cfg.LabelTop[i] = top
+	cfg.LabelBottom[i] = bottom
+}
+
+// drawGroupLabel 绘制缩写基团标签（见 abbrev.go），数字写成下标（CF3、CO2Me）。
+// 连接点所在的字符以 (x, y) 为中心：正写时是第一个字符，反写（键从右侧连入）时是最后一个字符
+func drawGroupLabel(dc Renderer, cfg *MoleculeRenderConfig, text string, i int, x, y float64, left bool) {
+	fs := cfg.FontSize
+	small := fs * labelScriptScale
+
+	// 按字母/数字切成若干段，先量出总宽度
+	type run struct {
+		s     string
+		sub   bool
+		width float64
+	}
+	var runs []run
+	for _, r := range text {
+		sub := r >= '0' && r <= '9'
+		if n := len(runs); n > 0 && runs[n-1].sub == sub {
+			runs[n-1].s += string(r)
+		} else {
+			runs = append(runs, run{s: string(r), sub: sub})
+		}
+	}
+	total := 0.0
+	for k := range runs {
+		if runs[k].sub {
+			dc.SetFont(cfg.FontFamily, small)
+		} else {
+			dc.SetFont(cfg.FontFamily, fs)
+		}
+		runs[k].width, _ = dc.MeasureString(runs[k].s)
+		total += runs[k].width
+	}
+	dc.SetFont(cfg.FontFamily, fs)
+	anchor := []rune(text)[0]
+	if left {
+		anchor = []rune(text)[len([]rune(text))-1]
+	}
+	aw, _ := dc.MeasureString(string(anchor))
+
+	start := x - aw/2
+	if left {
+		start = x + aw/2 - total
+	}
+	base := y + dc.FontHeight()/2
+	bottom := fs / 2
+	for _, r := range runs {
+		if r.sub {
+			dc.SetFont(cfg.FontFamily, small)
+			dc.DrawString(r.s, start, base+small*labelSubscriptDy)
+			bottom = math.Max(bottom, fs/2+small*labelSubscriptDy)
+		} else {
+			dc.SetFont(cfg.FontFamily, fs)
+			dc.DrawString(r.s, start, base)
+		}
+		start += r.width
+	}
+
+	dc.SetFont(cfg.FontFamily, fs)
+	if left {
+		cfg.LabelLeft[i] = total - aw/2
+		cfg.LabelRight[i] = aw / 2
+	} else {
+		cfg.LabelLeft[i] = aw / 2
+		cfg.LabelRight[i] = total - aw/2
+	}
+	cfg.LabelTop[i] = fs / 2
+	cfg.LabelBottom[i] = bottom
+}
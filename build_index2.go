@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -21,15 +22,21 @@ type task struct {
 }
 
 func main() {
-	if len(os.Args) != 3 {
-		fmt.Println("用法: build_index <input.sdf> <output.index>")
+	args := os.Args[1:]
+	// -ignore-isotopes：同位素不算作不同取代基，须与服务端 CHIRAL_IGNORE_ISOTOPES 一致
+	if len(args) > 0 && args[0] == "-ignore-isotopes" {
+		DefaultIgnoreIsotopes = true
+		args = args[1:]
+	}
+	if len(args) != 2 {
+		fmt.Println("用法: build_index [-ignore-isotopes] <input.sdf> <output.index>")
 		os.Exit(1)
 	}
-	if err := buildIndexParallel(os.Args[1], os.Args[2]); err != nil {
+	if err := buildIndexParallel(args[0], args[1]); err != nil {
 		fmt.Println("生成索引失败:", err)
 		os.Exit(1)
 	}
-	fmt.Println("索引生成完毕:", os.Args[2])
+	fmt.Println("索引生成完毕:", args[1])
 }
 
 func buildIndexParallel(sdfPath, idxPath string) error {
@@ -86,24 +93,21 @@ func buildIndexParallel(sdfPath, idxPath string) error {
 		go func() {
 			defer wg.Done()
 			for t := range taskCh {
-				// 设置超时处理
-				done := make(chan struct{})
-				go func() {
-					defer close(done)
-					mol, err := ParseMolString(t.MolStr)
-					if err == nil {
-						Hydrogenate(mol)
-						if len(GetMoleculeChiralCarbons(mol)) >= 3 {
-							resultCh <- t.Offset
-						}
-					}
-				}()
-				select {
-				case <-done:
-					// 正常完成
-				case <-time.After(Timeout):
+				mol, err := ParseMolString(t.MolStr)
+				if err != nil {
+					continue
+				}
+				// 超时由 ctx 控制，分析会自行中止，不会遗留 goroutine
+				ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+				chiral, err := GetMoleculeChiralCarbonsCtx(ctx, mol, 0)
+				cancel()
+				if err != nil {
 					// 超时，跳过当前分子
-					fmt.Printf("分子 offset=%d 处理超时，自动跳过\n", t.Offset)
+					fmt.Printf("分子 offset=%d 处理超时，自动跳过: %v\n", t.Offset, err)
+					continue
+				}
+				if len(chiral) >= 3 {
+					resultCh <- t.Offset
 				}
 			}
 		}()
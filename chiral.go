@@ -2,20 +2,80 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"math"
 )
 
 // Molecule 中添加的缓存字段示例：
-// bondIDMap map[Bond]int
 // atomBondMap map[int][]int
 // chainTTL    int
 
+// BudgetExceededError is returned when chirality analysis runs out of its step
+// budget or its context is cancelled before finishing.
+type BudgetExceededError struct {
+	Steps int   // 中止前已执行的链比较步数
+	Cause error // nil 表示步数耗尽，否则为 ctx.Err()
+}
+
+func (e *BudgetExceededError) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("chirality analysis aborted after %d steps: %v", e.Steps, e.Cause)
+	}
+	return fmt.Sprintf("chirality analysis budget exceeded after %d steps", e.Steps)
+}
+
+func (e *BudgetExceededError) Unwrap() error { return e.Cause }
+
+// ctxCheckInterval 每隔多少步检查一次 ctx，避免每步都调用 ctx.Err()
+const ctxCheckInterval = 1024
+
+// analysisBudget 在 compareChainRec 的递归中计数并检查取消
+type analysisBudget struct {
+	ctx   context.Context
+	limit int // <=0 表示不限步数
+	steps int
+	err   error
+}
+
+// step 计一步，预算耗尽或 ctx 结束时返回 false 并记录 err
+func (b *analysisBudget) step() bool {
+	if b == nil {
+		return true
+	}
+	if b.err != nil {
+		return false
+	}
+	if b.limit > 0 && b.steps >= b.limit {
+		b.err = &BudgetExceededError{Steps: b.steps}
+		return false
+	}
+	b.steps++
+	if b.steps%ctxCheckInterval == 0 {
+		if err := b.ctx.Err(); err != nil {
+			b.err = &BudgetExceededError{Steps: b.steps, Cause: err}
+			return false
+		}
+	}
+	return true
+}
+
 // GetMoleculeChiralCarbons returns all chiral carbon atom indices (1-based).
 func GetMoleculeChiralCarbons(m *Molecule) []int {
+	out, _ := GetMoleculeChiralCarbonsCtx(context.Background(), m, 0)
+	return out
+}
+
+// GetMoleculeChiralCarbonsCtx is GetMoleculeChiralCarbons bounded by ctx and by
+// maxSteps chain comparisons (0 = unlimited). On abort it returns a *BudgetExceededError.
+func GetMoleculeChiralCarbonsCtx(ctx context.Context, m *Molecule, maxSteps int) ([]int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, &BudgetExceededError{Cause: err}
+	}
 	Hydrogenate(m)  // 确保隐式 HCount 正确
 	m.buildCaches() // 初始化缓存
 
+	budget := &analysisBudget{ctx: ctx, limit: maxSteps}
 	var out []int
 	//fmt.Printf("→ Molecule: %d atoms, %d bonds\n", len(m.Atoms), len(m.Bonds))
 	for zero := range m.Atoms {
@@ -25,13 +85,16 @@ func GetMoleculeChiralCarbons(m *Molecule) []int {
 		//fmt.Printf("Atom %2d (%s): bonds=%v, HCount=%d\n",
 		//	zero+1, atom.Element, bondIDs, atom.HCount,
 		//)
-		if m.isChiralCarbon0(zero) {
+		if m.isChiralCarbon0(zero, budget) {
 			//fmt.Printf("  -> CHIRAL!\n")
 			out = append(out, zero+1)
 		}
+		if budget.err != nil {
+			return nil, budget.err
+		}
 	}
 	//fmt.Printf("=> Chiral Carbons: %v\n", out)
-	return out
+	return out, nil
 }
 
 // GetAtomDeclaredBonds returns all bonds connected to atom at 1-based index idx.
@@ -50,7 +113,8 @@ func (m *Molecule) GetAtomDeclaredBonds(idx int) []Bond {
 // isChiralCarbon0 determines if the atom at zero-based index c0 is a chiral carbon.
 // Assumes m.buildCaches() has been called so that m.atomBondMap and m.chainTTL are initialized.
 // isChiralCarbon0 determines if the atom at zero-based index c0 is a chiral carbon.
-func (m *Molecule) isChiralCarbon0(c0 int) bool {
+// budget may be nil; once it is exhausted the result is meaningless and budget.err is set.
+func (m *Molecule) isChiralCarbon0(c0 int, budget *analysisBudget) bool {
 	a := &m.Atoms[c0]
 	// 跳过非碳
 	if a.Element != "C" {
@@ -69,9 +133,7 @@ func (m *Molecule) isChiralCarbon0(c0 int) bool {
 		if other0 == c0 {
 			other0 = b.To
 		}
-		other := &m.Atoms[other0]
-		declIDs := m.atomBondMap[other0]
-		if other.Element == "H" && len(declIDs) == 1 {
+		if m.isPlainTerminalH(other0) {
 			hcnt++
 		} else {
 			nonHBonds = append(nonHBonds, bid)
@@ -92,7 +154,7 @@ func (m *Molecule) isChiralCarbon0(c0 int) bool {
 
 	for _, p := range pairs {
 		visited := make(map[[4]int]bool)
-		if m.compareChainRec(c0, c0, nonHBonds[p[0]], nonHBonds[p[1]], m.chainTTL, visited) {
+		if m.compareChainRec(c0, c0, nonHBonds[p[0]], nonHBonds[p[1]], m.chainTTL, visited, budget) {
 			//fmt.Printf("    → chains %v match, not chiral\n", p)
 			return false
 		}
@@ -100,19 +162,34 @@ func (m *Molecule) isChiralCarbon0(c0 int) bool {
 	return true
 }
 
+// isPlainTerminalH reports whether atom other0 is a terminal hydrogen that counts as an
+// ordinary H. 同位素标记的 D/T 视为独立取代基，除非 m.IgnoreIsotopes。
+func (m *Molecule) isPlainTerminalH(other0 int) bool {
+	other := &m.Atoms[other0]
+	if other.Element != "H" || len(m.atomBondMap[other0]) != 1 {
+		return false
+	}
+	return other.Isotope == 0 || m.IgnoreIsotopes
+}
+
+// sameNuclide compares element and, unless m.IgnoreIsotopes, mass number.
+func (m *Molecule) sameNuclide(a1, a2 *Atom) bool {
+	if a1.Element != a2.Element {
+		return false
+	}
+	return m.IgnoreIsotopes || a1.Isotope == a2.Isotope
+}
+
 // buildCaches initializes caching structures for quick lookups
 func (m *Molecule) buildCaches() {
-	if m.bondIDMap != nil {
+	if m.atomBondMap != nil {
 		return
 	}
-	fmt.Println("Building caches...")
-	m.bondIDMap = make(map[Bond]int, len(m.Bonds))
 	m.atomBondMap = make(map[int][]int, len(m.Atoms))
 	m.chainTTL = 3 + int(math.Sqrt(float64(len(m.Atoms))))
 
 	for i, b := range m.Bonds {
 		id := i + 1
-		m.bondIDMap[b] = id
 		// Bond.From/To are zero-based indices
 		from0 := int(b.From)
 		to0 := int(b.To)
@@ -124,8 +201,19 @@ func (m *Molecule) buildCaches() {
 	}
 }
 
+// invalidateCaches drops the adjacency caches so the next buildCaches rebuilds them.
+// Must be called after any change to m.Atoms or m.Bonds.
+func (m *Molecule) invalidateCaches() {
+	m.atomBondMap = nil
+	m.chainTTL = 0
+}
+
 // compareChainRec recursively compares two substituent chains for identity, with cycle detection
-func (m *Molecule) compareChainRec(atom1, atom2, chain1, chain2, ttl int, visited map[[4]int]bool) bool {
+// 预算耗尽时直接返回 true，让调用方尽快退出递归
+func (m *Molecule) compareChainRec(atom1, atom2, chain1, chain2, ttl int, visited map[[4]int]bool, budget *analysisBudget) bool {
+	if !budget.step() {
+		return true
+	}
 	key := [4]int{atom1, atom2, chain1, chain2}
 	if visited[key] {
 		return true
@@ -155,13 +243,13 @@ func (m *Molecule) compareChainRec(atom1, atom2, chain1, chain2, ttl int, visite
 		next2 = int(b2.From)
 	}
 
-	// Compare bond order and element
+	// Compare bond order, element and isotope
 	if b1.Order != b2.Order {
 		return false
 	}
 	a1 := &m.Atoms[next1]
 	a2 := &m.Atoms[next2]
-	if a1.Element != a2.Element {
+	if !m.sameNuclide(a1, a2) {
 		return false
 	}
 
@@ -179,9 +267,7 @@ func (m *Molecule) compareChainRec(atom1, atom2, chain1, chain2, ttl int, visite
 		if other0 == next1 {
 			other0 = int(b.To)
 		}
-		other := &m.Atoms[other0]
-		declIDs := m.atomBondMap[other0]
-		if other.Element == "H" && len(declIDs) == 1 {
+		if m.isPlainTerminalH(other0) {
 			h1++
 		} else {
 			subs1 = append(subs1, bid)
@@ -196,9 +282,7 @@ func (m *Molecule) compareChainRec(atom1, atom2, chain1, chain2, ttl int, visite
 		if other0 == next2 {
 			other0 = int(b.To)
 		}
-		other := &m.Atoms[other0]
-		declIDs := m.atomBondMap[other0]
-		if other.Element == "H" && len(declIDs) == 1 {
+		if m.isPlainTerminalH(other0) {
 			h2++
 		} else {
 			subs2 = append(subs2, bid)
@@ -215,7 +299,7 @@ func (m *Molecule) compareChainRec(atom1, atom2, chain1, chain2, ttl int, visite
 	for _, id1 := range subs1 {
 		matched := false
 		for _, id2 := range subs2 {
-			if m.compareChainRec(next1, next2, id1, id2, ttl, visited) {
+			if m.compareChainRec(next1, next2, id1, id2, ttl, visited, budget) {
 				matched = true
 				break
 			}
@@ -231,5 +315,5 @@ func (m *Molecule) compareChainRec(atom1, atom2, chain1, chain2, ttl int, visite
 func CompareChain(m *Molecule, center, c1, c2 int) bool {
 	m.buildCaches()
 	visited := make(map[[4]int]bool)
-	return m.compareChainRec(center, center, c1, c2, m.chainTTL, visited)
+	return m.compareChainRec(center, center, c1, c2, m.chainTTL, visited, nil)
 }
@@ -0,0 +1,276 @@
+// File: cip.go
+package main
+
+import (
+	"context"
+	"sort"
+)
+
+// CIP 优先级与 R/S 标记（简化版序列规则）：
+// 按层级有向图逐层比较，规则 1a 比原子序数，规则 2 比质量数；
+// 重键与成环处补重复原子。不处理规则 3-5（双键 Z/E、手性辅助优先级），遇到平局视为无法判定。
+
+// atomicNumber 常见元素的原子序数，未收录的元素按 0（最低）处理
+var atomicNumber = map[string]int{
+	"H": 1, "He": 2, "Li": 3, "Be": 4, "B": 5, "C": 6, "N": 7, "O": 8, "F": 9, "Ne": 10,
+	"Na": 11, "Mg": 12, "Al": 13, "Si": 14, "P": 15, "S": 16, "Cl": 17, "Ar": 18,
+	"K": 19, "Ca": 20, "Fe": 26, "Co": 27, "Ni": 28, "Cu": 29, "Zn": 30,
+	"Ga": 31, "Ge": 32, "As": 33, "Se": 34, "Br": 35, "Kr": 36,
+	"Sn": 50, "Sb": 51, "Te": 52, "I": 53, "Xe": 54, "Pt": 78, "Au": 79, "Hg": 80, "Pb": 82,
+}
+
+// maxCIPNodes 单个分支展开的节点上限，超过后按平局处理，防止稠环分子指数膨胀
+const maxCIPNodes = 5000
+
+// cipImplicitH 表示中心原子上的隐式氢（不对应 m.Atoms 中的原子）
+const cipImplicitH = -1
+
+// cipNode 层级有向图中的一个节点
+type cipNode struct {
+	atom   int // 0-based 原子下标；cipImplicitH 为隐式氢
+	parent int // 父节点在 cipTree.nodes 中的下标，根为 -1
+	dup    bool
+}
+
+type cipTree struct {
+	m      *Molecule
+	nodes  []cipNode
+	budget *analysisBudget // 每展开一个节点计一步，可为 nil
+}
+
+// key 节点在指定规则下的比较值：rule 1 为原子序数，rule 2 为质量数
+func (t *cipTree) key(n int, rule int) int {
+	a := t.nodes[n].atom
+	if a == cipImplicitH {
+		return 1
+	}
+	atom := &t.m.Atoms[a]
+	if rule == 1 {
+		return atomicNumber[atom.Element]
+	}
+	if atom.Isotope > 0 {
+		return atom.Isotope
+	}
+	return standardMass[atom.Element]
+}
+
+func (t *cipTree) add(atom, parent int, dup bool) int {
+	t.nodes = append(t.nodes, cipNode{atom: atom, parent: parent, dup: dup})
+	return len(t.nodes) - 1
+}
+
+// onPath 原子是否已出现在节点 n 到根的路径上
+func (t *cipTree) onPath(n, atom int) bool {
+	for ; n >= 0; n = t.nodes[n].parent {
+		if t.nodes[n].atom == atom {
+			return true
+		}
+	}
+	return false
+}
+
+// expand 生成节点 n 的子节点：邻居（成环处为重复原子）、重键的重复原子、隐式氢。重复原子没有子节点
+func (t *cipTree) expand(n int) []int {
+	nd := t.nodes[n]
+	if nd.dup || nd.atom == cipImplicitH || !t.budget.step() {
+		return nil
+	}
+	parentAtom := -2
+	if nd.parent >= 0 {
+		parentAtom = t.nodes[nd.parent].atom
+	}
+	var kids []int
+	for _, bid := range t.m.atomBondMap[nd.atom] {
+		b := t.m.Bonds[bid-1]
+		other := b.From
+		if other == nd.atom {
+			other = b.To
+		}
+		extra := b.Order - 1
+		if b.Order == 4 { // 芳香键按 1.5 级，补一个重复原子
+			extra = 1
+		}
+		if other == parentAtom {
+			for k := 0; k < extra; k++ {
+				kids = append(kids, t.add(other, n, true))
+			}
+			continue
+		}
+		kids = append(kids, t.add(other, n, t.onPath(n, other)))
+		for k := 0; k < extra; k++ {
+			kids = append(kids, t.add(other, n, true))
+		}
+	}
+	for k := 0; k < t.m.Atoms[nd.atom].HCount; k++ {
+		kids = append(kids, t.add(cipImplicitH, n, false))
+	}
+	return kids
+}
+
+// compareBranches 比较从 c0 出发、经由邻居 a、b 的两个分支，返回 >0 表示 a 优先，0 为平局。
+// 预算耗尽时按平局处理，budget.err 记下原因
+func (m *Molecule) compareBranches(c0, a, b int, budget *analysisBudget) int {
+	for rule := 1; rule <= 2; rule++ {
+		if d := m.compareBranchesRule(c0, a, b, rule, budget); d != 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+func (m *Molecule) compareBranchesRule(c0, a, b, rule int, budget *analysisBudget) int {
+	ta, tb := &cipTree{m: m, budget: budget}, &cipTree{m: m, budget: budget}
+	rootA, rootB := ta.add(c0, -1, false), tb.add(c0, -1, false)
+	sphereA := []int{ta.add(a, rootA, false)}
+	sphereB := []int{tb.add(b, rootB, false)}
+	if a == cipImplicitH {
+		ta.nodes[sphereA[0]].dup = true
+	}
+	if b == cipImplicitH {
+		tb.nodes[sphereB[0]].dup = true
+	}
+	if d := ta.key(sphereA[0], rule) - tb.key(sphereB[0], rule); d != 0 {
+		return d
+	}
+	for len(sphereA) > 0 || len(sphereB) > 0 {
+		if len(ta.nodes) > maxCIPNodes || len(tb.nodes) > maxCIPNodes || (budget != nil && budget.err != nil) {
+			return 0
+		}
+		var nextA, nextB []int
+		// 按上一层的顺序逐个比较子节点集合，集合内按优先级从高到低
+		for i := 0; i < len(sphereA) || i < len(sphereB); i++ {
+			var kidsA, kidsB []int
+			if i < len(sphereA) {
+				kidsA = ta.sortedKids(sphereA[i], rule)
+			}
+			if i < len(sphereB) {
+				kidsB = tb.sortedKids(sphereB[i], rule)
+			}
+			for k := 0; k < len(kidsA) || k < len(kidsB); k++ {
+				ka, kb := 0, 0 // 缺位按虚原子（0）处理
+				if k < len(kidsA) {
+					ka = ta.key(kidsA[k], rule)
+				}
+				if k < len(kidsB) {
+					kb = tb.key(kidsB[k], rule)
+				}
+				if ka != kb {
+					return ka - kb
+				}
+			}
+			nextA = append(nextA, kidsA...)
+			nextB = append(nextB, kidsB...)
+		}
+		sphereA, sphereB = nextA, nextB
+	}
+	return 0
+}
+
+func (t *cipTree) sortedKids(n, rule int) []int {
+	kids := t.expand(n)
+	sort.SliceStable(kids, func(i, j int) bool { return t.key(kids[i], rule) > t.key(kids[j], rule) })
+	return kids
+}
+
+// CIPNeighbours 返回中心 c0（0-based）的取代基按 CIP 优先级从高到低排列，
+// 隐式氢记为 cipImplicitH。任意两个取代基平局或不是四取代时 ok 为 false
+func (m *Molecule) CIPNeighbours(c0 int) (nbrs []int, ok bool) {
+	return m.cipNeighbours(c0, nil)
+}
+
+func (m *Molecule) cipNeighbours(c0 int, budget *analysisBudget) (nbrs []int, ok bool) {
+	m.buildCaches()
+	for _, bid := range m.atomBondMap[c0] {
+		b := m.Bonds[bid-1]
+		if b.From == c0 {
+			nbrs = append(nbrs, b.To)
+		} else {
+			nbrs = append(nbrs, b.From)
+		}
+	}
+	for k := 0; k < m.Atoms[c0].HCount; k++ {
+		nbrs = append(nbrs, cipImplicitH)
+	}
+	if len(nbrs) != 4 {
+		return nil, false
+	}
+	sort.SliceStable(nbrs, func(i, j int) bool { return m.compareBranches(c0, nbrs[i], nbrs[j], budget) > 0 })
+	for i := 0; i+1 < len(nbrs); i++ {
+		if m.compareBranches(c0, nbrs[i], nbrs[i+1], budget) == 0 {
+			return nil, false
+		}
+	}
+	return nbrs, true
+}
+
+// wedgeDepth 2D 结构中楔形键端点相对纸面的高度（单位为平均键长）
+const wedgeDepth = 0.8
+
+// CIPLabel returns "R" or "S" for the atom at 1-based index idx, or "" when the
+// configuration cannot be determined (ties, no 3D coordinates and no wedge at the centre).
+func (m *Molecule) CIPLabel(idx int) string {
+	return m.cipLabel(idx, nil)
+}
+
+// CIPLabelsCtx 为 centres（1-based）逐个计算 CIP 标记，步数与 ctx 限制同 GetMoleculeChiralCarbonsCtx，
+// 所有中心共用一份预算；耗尽时返回 *BudgetExceededError
+func CIPLabelsCtx(ctx context.Context, m *Molecule, centres []int, maxSteps int) (map[int]string, error) {
+	budget := &analysisBudget{ctx: ctx, limit: maxSteps}
+	labels := make(map[int]string, len(centres))
+	for _, idx := range centres {
+		if err := ctx.Err(); err != nil {
+			return nil, &BudgetExceededError{Steps: budget.steps, Cause: err}
+		}
+		labels[idx] = m.cipLabel(idx, budget)
+		if budget.err != nil {
+			return nil, budget.err
+		}
+	}
+	return labels, nil
+}
+
+func (m *Molecule) cipLabel(idx int, budget *analysisBudget) string {
+	c0 := idx - 1
+	nbrs, ok := m.cipNeighbours(c0, budget)
+	if !ok {
+		return ""
+	}
+	geo := m
+	if !m.Is3D() {
+		// 2D：以中心原子为起点的楔形键把邻居抬出/压入纸面
+		geo = m.Copy()
+		depth := wedgeDepth * m.AverageBondLength()
+		wedged := false
+		for _, b := range m.Bonds {
+			if b.From != c0 || (b.Stereo != 1 && b.Stereo != 6) {
+				continue
+			}
+			if b.Stereo == 1 {
+				geo.Atoms[b.To].Z = depth
+			} else {
+				geo.Atoms[b.To].Z = -depth
+			}
+			wedged = true
+		}
+		if !wedged {
+			return ""
+		}
+	}
+	// 隐式氢排在最后（优先级最低时），交给 TetrahedralSign3D 按 3 个邻居处理
+	if nbrs[3] == cipImplicitH {
+		nbrs = nbrs[:3]
+	} else {
+		for _, n := range nbrs {
+			if n == cipImplicitH {
+				return "" // 隐式氢不是最低优先级（例如 C-H 连着更轻的同位素），几何上无法定位
+			}
+		}
+	}
+	switch geo.TetrahedralSign3D(c0, nbrs) {
+	case 1:
+		return "R"
+	case -1:
+		return "S"
+	}
+	return ""
+}
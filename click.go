@@ -0,0 +1,53 @@
+// File: click.go
+package main
+
+import "math"
+
+// 题目模式
+const (
+	ModeGrid  = "grid"  // 勾选格子
+	ModeClick = "click" // 直接点击手性原子
+	ModeTiles = "tiles" // 按格子切成单独图片、打乱顺序，勾选含手性中心的切片（见 tiles.go）
+	ModeRS    = "rs"    // Fischer 投影，按编号回答每个手性中心是 R 还是 S（见 fischer.go）
+	Mode3D    = "3d"    // 随机角度的球棍模型，点击手性原子（见 render3d.go）
+)
+
+// clickRadiusRatio 点击容差半径与平均键长（像素）的比例。小于 0.5，
+// 保证相邻两个手性原子的容差圆不重叠，每次点击最多命中一个原子
+const clickRadiusRatio = 0.4
+
+// AtomPixel 原子（1-based）中心在画布上的像素坐标
+func AtomPixel(mol *Molecule, cfg *MoleculeRenderConfig, idx int) Point {
+	a := mol.Atoms[idx-1]
+	return Point{
+		X: cfg.OffsetX + cfg.FontSize + cfg.ScaleFactor*(a.X-mol.MinX()),
+		Y: float64(cfg.Height) - cfg.FontSize - cfg.ScaleFactor*(a.Y-mol.MinY()),
+	}
+}
+
+// ClickRadius 点击模式下的容差半径（像素）
+func ClickRadius(mol *Molecule, cfg *MoleculeRenderConfig) float64 {
+	return math.Max(clickRadiusRatio*mol.AverageBondLength()*cfg.ScaleFactor, 4)
+}
+
+// MatchClicks 每个点击都要落在某个尚未命中的答案点的 radius 内，且点击数与答案数相同
+func MatchClicks(answers, clicks []Point, radius float64) bool {
+	if len(clicks) != len(answers) {
+		return false
+	}
+	hit := make([]bool, len(answers))
+	for _, c := range clicks {
+		matched := false
+		for i, p := range answers {
+			if !hit[i] && math.Hypot(c.X-p.X, c.Y-p.Y) <= radius {
+				hit[i] = true
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
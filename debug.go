@@ -0,0 +1,152 @@
+// File: debug.go
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// AdminToken 管理接口的访问令牌，main 中由环境变量 CHIRAL_ADMIN_TOKEN 设置；为空时管理接口关闭
+var AdminToken string
+
+// 调试叠加层的固定配色，与主题无关，保证在任何底色上都醒目
+const (
+	debugIndexColor  = "#1565c0" // 原子序号
+	debugCentreColor = "#d81b60" // 手性中心圆圈、CIP 标记
+	debugCellColor   = "#ff6f00" // 答案格子边框
+)
+
+// DebugOverlay 在渲染结果上叠加解题信息，用于人工核对有争议的题目
+type DebugOverlay struct {
+	Chiral []int          // 检测到的手性中心（1-based），圈出并标出所在格子
+	CIP    map[int]string // 手性中心的 R/S 标记，nil 表示不显示
+	Radius float64        // 点击模式的容差半径（像素），0 时按字号画圈
+}
+
+// drawDebugOverlay 画原子序号、手性中心、答案格子与可选的 CIP 标记
+func drawDebugOverlay(dc Renderer, mol *Molecule, cfg *MoleculeRenderConfig) {
+	d := cfg.Debug
+	lw := cfg.FontSize / 10
+
+	// 答案格子（只有一个格子时没有意义，例如点击模式）
+	if cfg.GridCountX*cfg.GridCountY > 1 {
+		dc.SetHexColor(debugCellColor)
+		dc.SetLineWidth(lw * 1.5)
+		for _, idx := range d.Chiral {
+			col, row, _ := AtomCell(mol, cfg, idx)
+			r := CellRect(cfg, col, row)
+			dc.DrawRectangle(float64(r.Min.X)+lw, float64(r.Min.Y)+lw, float64(r.Dx())-2*lw, float64(r.Dy())-2*lw)
+			dc.Stroke()
+		}
+	}
+
+	// 手性中心
+	radius := d.Radius
+	if radius <= 0 {
+		radius = cfg.FontSize * 0.7
+	}
+	dc.SetFont(cfg.FontFamily, cfg.FontSize*0.8)
+	for _, idx := range d.Chiral {
+		p := AtomPixel(mol, cfg, idx)
+		dc.SetHexColor(debugCentreColor)
+		dc.SetLineWidth(lw)
+		dc.DrawCircle(p.X, p.Y, radius)
+		dc.Stroke()
+		if label := d.CIP[idx]; label != "" {
+			dc.DrawStringAnchored("("+label+")", p.X, p.Y+radius, 0.5, 1)
+		}
+	}
+
+	// 原子序号（1-based，与日志和 chiral.go 一致），画在原子或其标签的右下
+	dc.SetHexColor(debugIndexColor)
+	dc.SetFont(cfg.FontFamily, cfg.FontSize*0.5)
+	for i := range mol.Atoms {
+		p := AtomPixel(mol, cfg, i+1)
+		dx := math.Max(cfg.LabelRight[i], cfg.FontSize*0.3)
+		dy := math.Max(cfg.LabelBottom[i], cfg.FontSize*0.3)
+		dc.DrawStringAnchored(strconv.Itoa(i+1), p.X+dx, p.Y+dy, 0, 1)
+	}
+}
+
+// debugCopy 复制渲染配置并挂上叠加层
+func (cfg *MoleculeRenderConfig) debugCopy(d *DebugOverlay) *MoleculeRenderConfig {
+	c := cfg.clone()
+	c.Debug = d
+	return c
+}
+
+// checkAdmin 校验 Authorization: Bearer <AdminToken>
+func checkAdmin(r *http.Request) bool {
+	if AdminToken == "" {
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(AdminToken)) == 1
+}
+
+// debugCIPLabels 出题时为管理接口预先算好手性中心的 CIP 标记；管理接口未开启时不算。
+// 超出预算只记日志、不显示标记，不影响出题
+func debugCIPLabels(ctx context.Context, mol *Molecule, chiral []int) map[int]string {
+	if AdminToken == "" {
+		return nil
+	}
+	cip, err := CIPLabelsCtx(ctx, mol, chiral, chiralAnalysisSteps)
+	if err != nil {
+		log.Printf("CIP labels skipped: %v", err)
+		return nil
+	}
+	return cip
+}
+
+// handleAdminChallenge 重新绘制题目并叠加解题信息：
+// GET /api/admin/challenge?uuid=...&cip=1&format=svg&scale=2
+func handleAdminChallenge(w http.ResponseWriter, r *http.Request) {
+	if AdminToken == "" {
+		http.NotFound(w, r)
+		return
+	}
+	// 限流放在鉴权之前，同时限制猜令牌
+	if !limitClient(w, ClientIP(r), adminLimiter) {
+		return
+	}
+	if !checkAdmin(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	q := r.URL.Query()
+	chal, ok := getChallenge(q.Get("uuid"))
+	if !ok || chal.Mol == nil || chal.Render == nil {
+		http.Error(w, "uuid not found", http.StatusNotFound)
+		return
+	}
+
+	d := &DebugOverlay{Chiral: chal.Chiral, Radius: chal.Radius}
+	if q.Get("cip") == "1" {
+		d.CIP = chal.CIP
+	}
+	cfg := chal.Render.debugCopy(d)
+	if f := q.Get("format"); f != "" {
+		cfg.Format = f
+	}
+	scale, err := parseScale(q.Get("scale"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if scale > 1 {
+		cfg = cfg.Scaled(scale)
+	}
+	img, _, err := RenderMoleculeImage(chal.Mol, cfg)
+	if err != nil {
+		http.Error(w, "failed to draw molecule: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", ImageMIMEType(cfg.Format))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(img)
+}
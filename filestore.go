@@ -0,0 +1,180 @@
+// File: filestore.go
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FileStore 文件存储：目录中每道题一个 gob 文件（<id>.gob），文件的修改时间记为过期时间。
+// 写入先写临时文件再 rename；Consume 先把文件 rename 成独占的名字再读取删除，
+// rename 是原子的，多个实例共用同一目录时也只有一个能取到。重启后未过期的题目依然有效。
+// 容量上限只在 Sweep 时执行（超出时按过期时间删除最早的），Put 不数文件：
+// 两次清理之间最多可多出 SweepInterval 内新出的题目，由出题限流（见 ratelimit.go）约束
+type FileStore struct {
+	dir string
+	ttl time.Duration
+	max int
+}
+
+const (
+	fileStoreExt       = ".gob"
+	fileStoreTmpPrefix = ".tmp-"   // 写入中的临时文件
+	fileStoreClaimPref = ".claim-" // Consume 取走、尚未删除的文件
+)
+
+// NewFileStore creates dir if needed and returns a store backed by it.
+func NewFileStore(dir string, ttl time.Duration, max int) (*FileStore, error) {
+	if dir == "" {
+		return nil, errors.New("file store needs a directory")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir, ttl: ttl, max: max}, nil
+}
+
+// path 题目文件路径。ID 来自请求参数，只接受字母、数字和连字符，防止路径穿越
+func (s *FileStore) path(id string) (string, bool) {
+	if id == "" || len(id) > 64 {
+		return "", false
+	}
+	for _, r := range id {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '-') {
+			return "", false
+		}
+	}
+	return filepath.Join(s.dir, id+fileStoreExt), true
+}
+
+func (s *FileStore) Put(id string, c Challenge) (time.Time, error) {
+	p, ok := s.path(id)
+	if !ok {
+		return time.Time{}, fmt.Errorf("invalid challenge id %q", id)
+	}
+	if c.Expires.IsZero() {
+		c.Expires = time.Now().Add(s.ttl)
+	}
+	expires := c.Expires
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&c); err != nil {
+		return time.Time{}, err
+	}
+	tmp := filepath.Join(s.dir, fileStoreTmpPrefix+id+"-"+uuid.New().String())
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o600); err != nil {
+		return time.Time{}, err
+	}
+	if err := os.Chtimes(tmp, expires, expires); err != nil {
+		os.Remove(tmp)
+		return time.Time{}, err
+	}
+	if err := os.Rename(tmp, p); err != nil {
+		os.Remove(tmp)
+		return time.Time{}, err
+	}
+	return expires, nil
+}
+
+func (s *FileStore) Get(id string) (Challenge, error) {
+	p, ok := s.path(id)
+	if !ok {
+		return Challenge{}, ErrChallengeNotFound
+	}
+	return s.read(p)
+}
+
+func (s *FileStore) Consume(id string) (Challenge, error) {
+	p, ok := s.path(id)
+	if !ok {
+		return Challenge{}, ErrChallengeNotFound
+	}
+	claim := filepath.Join(s.dir, fileStoreClaimPref+id+"-"+uuid.New().String())
+	if err := os.Rename(p, claim); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return Challenge{}, ErrChallengeNotFound
+		}
+		return Challenge{}, err
+	}
+	defer os.Remove(claim)
+	return s.read(claim)
+}
+
+// read 读取并解码题目文件，已过期的按不存在处理
+func (s *FileStore) read(p string) (Challenge, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return Challenge{}, ErrChallengeNotFound
+		}
+		return Challenge{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return Challenge{}, err
+	}
+	if time.Now().After(info.ModTime()) {
+		return Challenge{}, ErrChallengeNotFound
+	}
+	var c Challenge
+	if err := gob.NewDecoder(f).Decode(&c); err != nil {
+		return Challenge{}, fmt.Errorf("decode %s: %w", filepath.Base(p), err)
+	}
+	return c, nil
+}
+
+// Sweep 删除过期的题目文件，以及超过一个 TTL 仍未收尾的临时文件（实例在写入或验证中途退出）；
+// 剩余题目超过上限时按过期时间从早到晚删除
+func (s *FileStore) Sweep(now time.Time) (int, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return 0, err
+	}
+	type live struct {
+		name    string
+		expires time.Time
+	}
+	var alive []live
+	n := 0
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		name := e.Name()
+		switch {
+		case strings.HasPrefix(name, fileStoreTmpPrefix), strings.HasPrefix(name, fileStoreClaimPref):
+			// 临时文件的修改时间是写入时间或过期时间，放宽一个 TTL 再删
+			if now.Sub(info.ModTime()) > s.ttl {
+				os.Remove(filepath.Join(s.dir, name))
+			}
+		case strings.HasSuffix(name, fileStoreExt):
+			if now.After(info.ModTime()) {
+				if os.Remove(filepath.Join(s.dir, name)) == nil {
+					n++
+				}
+				continue
+			}
+			alive = append(alive, live{name, info.ModTime()})
+		}
+	}
+	if s.max > 0 && len(alive) > s.max {
+		sort.Slice(alive, func(i, j int) bool { return alive[i].expires.Before(alive[j].expires) })
+		for _, l := range alive[:len(alive)-s.max] {
+			if os.Remove(filepath.Join(s.dir, l.name)) == nil {
+				n++
+			}
+		}
+	}
+	return n, nil
+}
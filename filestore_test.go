@@ -0,0 +1,138 @@
+// File: filestore_test.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestFileStore(t *testing.T, max int) *FileStore {
+	t.Helper()
+	s, err := NewFileStore(t.TempDir(), time.Minute, max)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestFileStoreRoundTrip(t *testing.T) {
+	s := newTestFileStore(t, 0)
+	mol := &Molecule{
+		Atoms: []Atom{{X: 0, Y: 0, Element: "C", HCount: 1}, {X: 1.5, Y: 0, Element: "O", Isotope: 18, Charge: -1}},
+		Bonds: []Bond{{From: 0, To: 1, Order: 1, Stereo: 1}},
+	}
+	in := Challenge{
+		Mode:    ModeTiles,
+		Regions: []string{"t1", "t2"},
+		Answers: []string{"t2"},
+		Tiles:   map[string][]byte{"t1": {1, 2, 3}, "t2": {4, 5}},
+		Mol:     mol,
+		Render:  &MoleculeRenderConfig{Width: 300, Height: 200, FontSize: 14, GridCountX: 2, GridCountY: 1, ShownChiral: map[int]bool{1: true}},
+		Chiral:  []int{1},
+		CIP:     map[int]string{1: "R"},
+	}
+	expires, err := s.Put("abc-123", in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := s.Get("abc-123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !out.Expires.Equal(expires) {
+		t.Errorf("Expires = %v, want %v", out.Expires, expires)
+	}
+	in.Expires = out.Expires
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("round trip mismatch:\n got %+v\nwant %+v", out, in)
+	}
+}
+
+func TestFileStoreExpiryAndConsume(t *testing.T) {
+	s := newTestFileStore(t, 0)
+	s.Put("old", Challenge{Mode: ModeGrid, Expires: time.Now().Add(-time.Second)})
+	if _, err := s.Get("old"); !errors.Is(err, ErrChallengeNotFound) {
+		t.Errorf("Get expired: err = %v", err)
+	}
+	if _, err := s.Consume("old"); !errors.Is(err, ErrChallengeNotFound) {
+		t.Errorf("Consume expired: err = %v", err)
+	}
+
+	s.Put("live", Challenge{Mode: ModeGrid})
+	if _, err := s.Consume("live"); err != nil {
+		t.Fatalf("first Consume: %v", err)
+	}
+	if _, err := s.Consume("live"); !errors.Is(err, ErrChallengeNotFound) {
+		t.Errorf("second Consume: err = %v", err)
+	}
+}
+
+func TestFileStoreRejectsBadIDs(t *testing.T) {
+	s := newTestFileStore(t, 0)
+	for _, id := range []string{"", "../x", "a/b", "a.gob", string(make([]byte, 65))} {
+		if _, err := s.Put(id, Challenge{}); err == nil {
+			t.Errorf("Put(%q) succeeded", id)
+		}
+		if _, err := s.Get(id); !errors.Is(err, ErrChallengeNotFound) {
+			t.Errorf("Get(%q): err = %v", id, err)
+		}
+	}
+}
+
+// 两个 goroutine 同时验证同一道题，只能有一个取到
+func TestFileStoreConcurrentConsume(t *testing.T) {
+	s := newTestFileStore(t, 0)
+	const n = 50
+	for i := 0; i < n; i++ {
+		s.Put(fmt.Sprint("id-", i), Challenge{Mode: ModeGrid})
+	}
+	var wins [n][2]bool
+	var wg sync.WaitGroup
+	for g := 0; g < 2; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				_, err := s.Consume(fmt.Sprint("id-", i))
+				if err != nil && !errors.Is(err, ErrChallengeNotFound) {
+					t.Errorf("Consume: %v", err)
+				}
+				wins[i][g] = err == nil
+			}
+		}(g)
+	}
+	wg.Wait()
+	for i, w := range wins {
+		if w[0] == w[1] {
+			t.Errorf("challenge %d consumed by both or neither: %v", i, w)
+		}
+	}
+	if entries, _ := os.ReadDir(s.dir); len(entries) != 0 {
+		t.Errorf("%d files left after consuming everything", len(entries))
+	}
+}
+
+func TestFileStoreSweep(t *testing.T) {
+	s := newTestFileStore(t, 2)
+	s.Put("expired", Challenge{Expires: time.Now().Add(-time.Second)})
+	for i := 1; i <= 3; i++ {
+		s.Put(fmt.Sprint("live-", i), Challenge{Expires: time.Now().Add(time.Duration(i) * time.Minute)})
+	}
+	n, err := s.Sweep(time.Now())
+	if err != nil || n != 2 {
+		t.Fatalf("Sweep = %d, %v, want 2 (one expired, one over the cap)", n, err)
+	}
+	if _, err := s.Get("live-1"); !errors.Is(err, ErrChallengeNotFound) {
+		t.Errorf("earliest-expiring challenge kept over the cap: err = %v", err)
+	}
+	for _, id := range []string{"live-2", "live-3"} {
+		if _, err := s.Get(id); err != nil {
+			t.Errorf("Get(%s): %v", id, err)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+// File: fischer.go
+package main
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrNoFischerChain 分子里找不到适合画成 Fischer 投影的手性中心链
+var ErrNoFischerChain = errors.New("no chain of stereocentres suitable for a Fischer projection")
+
+// MinFischerCentres Fischer 题目至少要问几个手性中心。每个中心只有 R/S 两种答案，
+// 2 个中心盲猜有 1/4 的通过率，3 个降到 1/8
+const MinFischerCentres = 3
+
+// Fischer 投影中四个方向的空间位置：横向朝向观察者，竖向背离观察者
+var (
+	fischerUp    = Vec3{0, 1, -1}
+	fischerDown  = Vec3{0, -1, -1}
+	fischerLeft  = Vec3{-1, 0, 1}
+	fischerRight = Vec3{1, 0, 1}
+)
+
+// fischerBackbone 在非环碳原子组成的链中找一条包含最多手性中心（其次最长）的路径（0-based），
+// 较"氧化"的一端（连杂原子多的，如 CHO、COOH）朝上
+func (m *Molecule) fischerBackbone(chiral map[int]bool) []int {
+	m.buildCaches()
+	_, bondRing := m.BondRings()
+	ring := m.ringAtomSet(bondRing)
+	isChain := func(a int) bool { return m.Atoms[a].Element == "C" && !ring[a] }
+
+	var best []int
+	bestCentres := -1
+	var path []int
+	onPath := make(map[int]bool)
+	var dfs func(a, centres int)
+	dfs = func(a, centres int) {
+		path = append(path, a)
+		onPath[a] = true
+		if chiral[a] {
+			centres++
+		}
+		extended := false
+		for _, bid := range m.atomBondMap[a] {
+			b := m.Bonds[bid-1]
+			o := b.From + b.To - a
+			if b.Order == 1 && isChain(o) && !onPath[o] {
+				extended = true
+				dfs(o, centres)
+			}
+		}
+		if !extended && (centres > bestCentres || centres == bestCentres && len(path) > len(best)) {
+			best = append(best[:0:0], path...)
+			bestCentres = centres
+		}
+		onPath[a] = false
+		path = path[:len(path)-1]
+	}
+	for a := range m.Atoms {
+		if isChain(a) {
+			dfs(a, 0)
+		}
+	}
+	if len(best) > 1 && m.heteroNeighbours(best[len(best)-1]) > m.heteroNeighbours(best[0]) {
+		for i, j := 0, len(best)-1; i < j; i, j = i+1, j-1 {
+			best[i], best[j] = best[j], best[i]
+		}
+	}
+	return best
+}
+
+// heteroNeighbours 非碳、非氢邻居的键级之和（C=O 计 2）
+func (m *Molecule) heteroNeighbours(a int) int {
+	n := 0
+	for _, b := range m.GetAtomDeclaredBonds(a + 1) {
+		if e := m.Atoms[b.From+b.To-a].Element; e != "C" && e != "H" {
+			n += b.Order
+		}
+	}
+	return n
+}
+
+// condensedLabel 把 root 一侧（经 via 相连）的小基团写成缩合式：CHO、CH2OH、COOH、CH3…；
+// 不是"一个原子加若干端基"时改用缩写表（OMe、Ph…），都不行返回 false
+func (m *Molecule) condensedLabel(root, via int) (string, bool) {
+	a := &m.Atoms[root]
+	if a.Charge != 0 || a.Isotope != 0 {
+		return "", false
+	}
+	h := a.HCount
+	type sub struct {
+		order int
+		text  string
+	}
+	var subs []sub
+	terminal := true
+	for _, b := range m.GetAtomDeclaredBonds(root + 1) {
+		o := b.From + b.To - root
+		if o == via {
+			continue
+		}
+		oa := &m.Atoms[o]
+		if oa.Element == "H" && oa.Isotope == 0 {
+			h++
+			continue
+		}
+		if oa.Charge != 0 || oa.Isotope != 0 || m.heavyDegree(o) != 1 {
+			terminal = false
+			break
+		}
+		subs = append(subs, sub{b.Order, oa.Element + hydrogenText(oa.HCount)})
+	}
+	if !terminal {
+		_, bondRing := m.BondRings()
+		label := m.abbrevLabel(m.branchAtoms(root, via), root, via, bondRing, m.ringAtomSet(bondRing))
+		return label, label != ""
+	}
+	// 双键的端基在前：COOH、CHO
+	sort.SliceStable(subs, func(i, j int) bool { return subs[i].order > subs[j].order })
+	var sb strings.Builder
+	sb.WriteString(a.Element + hydrogenText(h))
+	for _, s := range subs {
+		sb.WriteString(s.text)
+	}
+	return sb.String(), true
+}
+
+func hydrogenText(n int) string {
+	switch n {
+	case 0:
+		return ""
+	case 1:
+		return "H"
+	}
+	return "H" + strconv.Itoa(n)
+}
+
+// FischerProjection 把手性中心链画成 Fischer 投影：主链竖直、较氧化的一端朝上，
+// 每个主链碳的两个取代基左右排开（隐式氢画成显式 H），两端写成缩合式标签。
+// 左右顺序由原分子的 CIP 构型决定（见 cip.go），因此原分子必须有 3D 坐标或楔形键。
+// 返回新分子、主链上的手性中心（新分子中 1-based，自上而下）及其 R/S
+func FischerProjection(mol *Molecule, chiral []int) (*Molecule, []int, []string, error) {
+	chiralSet := make(map[int]bool, len(chiral))
+	for _, idx := range chiral {
+		chiralSet[idx-1] = true
+	}
+	backbone := mol.fischerBackbone(chiralSet)
+	if len(backbone) < MinFischerCentres+2 {
+		return nil, nil, nil, ErrNoFischerChain
+	}
+
+	out := &Molecule{}
+	var centres []int
+	var labels []string
+	addLabel := func(root, via int, x, y float64) (int, error) {
+		a := mol.Atoms[root]
+		if mol.heavyDegree(root) == 1 && a.Charge == 0 && a.Isotope == 0 && a.Element != "C" {
+			// 单个杂原子：照常画元素标签（OH、NH2），由渲染器决定氢写在哪一侧
+			return out.AddAtom(Atom{Element: a.Element, HCount: a.HCount, X: x, Y: y}), nil
+		}
+		text, ok := mol.condensedLabel(root, via)
+		if !ok {
+			return -1, ErrNoFischerChain
+		}
+		return out.AddAtom(Atom{Element: a.Element, Label: text, X: x, Y: y}), nil
+	}
+
+	n := len(backbone)
+	ids := make([]int, n)
+	for k, a := range backbone {
+		y := float64(n - 1 - k)
+		if k == 0 || k == n-1 {
+			// 两端：缩合式标签
+			via := backbone[1]
+			if k == n-1 {
+				via = backbone[n-2]
+			}
+			if chiralSet[a] {
+				return nil, nil, nil, ErrNoFischerChain
+			}
+			id, err := addLabel(a, via, 0, y)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			ids[k] = id
+			continue
+		}
+		ids[k] = out.AddAtom(Atom{Element: mol.Atoms[a].Element, X: 0, Y: y})
+
+		// 横向取代基：非主链的邻居加隐式氢，cipImplicitH 表示氢
+		var subs []int
+		orders := make(map[int]int)
+		for _, b := range mol.GetAtomDeclaredBonds(a + 1) {
+			o := b.From + b.To - a
+			if o == backbone[k-1] || o == backbone[k+1] {
+				continue
+			}
+			subs = append(subs, o)
+			orders[o] = b.Order
+		}
+		for h := 0; h < mol.Atoms[a].HCount; h++ {
+			subs = append(subs, cipImplicitH)
+		}
+		if len(subs) > 2 {
+			return nil, nil, nil, ErrNoFischerChain
+		}
+
+		if chiralSet[a] {
+			label := mol.CIPLabel(a + 1)
+			if label == "" || len(subs) != 2 {
+				return nil, nil, nil, ErrNoFischerChain
+			}
+			// 先按 subs[0] 在左摆放，构型不符就左右对调
+			pos := map[int]Vec3{backbone[k-1]: fischerUp, backbone[k+1]: fischerDown, subs[0]: fischerLeft, subs[1]: fischerRight}
+			nbrs, _ := mol.CIPNeighbours(a)
+			sign := TetrahedralSign(pos[nbrs[0]], pos[nbrs[1]], pos[nbrs[2]], pos[nbrs[3]])
+			if (sign > 0) != (label == "R") {
+				subs[0], subs[1] = subs[1], subs[0]
+			}
+			centres = append(centres, ids[k]+1)
+			labels = append(labels, label)
+		}
+
+		for side, s := range subs {
+			x := -1.0
+			if side == 1 || len(subs) == 1 {
+				x = 1
+			}
+			if s == cipImplicitH {
+				h := out.AddAtom(Atom{Element: "H", X: x, Y: y})
+				out.AddBond(ids[k], h, 1)
+				continue
+			}
+			id, err := addLabel(s, a, x, y)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			out.AddBond(ids[k], id, orders[s])
+		}
+	}
+	for k := 1; k < n; k++ {
+		out.AddBond(ids[k-1], ids[k], 1)
+	}
+	if len(centres) < MinFischerCentres {
+		return nil, nil, nil, ErrNoFischerChain
+	}
+	return out, centres, labels, nil
+}
+
+// FischerRenderSizing Fischer 投影的尺寸：横键要容得下两侧标签，键长比普通结构式长
+var FischerRenderSizing = RenderSizing{Bond: 60, MinBond: 24, MaxSize: 600}
+
+// FischerRenderConfig 为 FischerProjection 的结果生成渲染配置：不画网格，
+// 左右按最长的标签留白，免得 HOH2C、COOH 之类被画布截断
+func FischerRenderConfig(fm *Molecule, sz RenderSizing) (*MoleculeRenderConfig, error) {
+	cfg, err := SizedRenderConfig(fm, sz, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	cfg.DrawGrid = false
+	longest := 1
+	for _, a := range fm.Atoms {
+		n := len(a.Element) + len(hydrogenText(a.HCount))
+		if a.Label != "" {
+			n = len(a.Label)
+		}
+		longest = max(longest, n)
+	}
+	pad := int(0.6 * float64(longest) * cfg.FontSize)
+	cfg.OffsetX += float64(pad)
+	cfg.Width += 2 * pad
+	return cfg, nil
+}
@@ -0,0 +1,191 @@
+// File: fonts.go
+package main
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/math/fixed"
+)
+
+// fontFamily 一个字体族：主字体在前，后面是缺字时依次尝试的回退字体。
+// 字体不会嵌入 SVG，css/weight 是浏览器端使用的系统字体，应写通用字体族
+type fontFamily struct {
+	css    string // SVG 输出使用的 font-family
+	weight string // SVG 输出使用的 font-weight，空为默认
+	fonts  []*truetype.Font
+}
+
+// DefaultFontFamily 未指定字体时使用，main 中可由环境变量 CHIRAL_FONT 覆盖
+var DefaultFontFamily = "go"
+
+var (
+	fontMu       sync.RWMutex
+	fontFamilies = make(map[string]*fontFamily)
+
+	// fallbackFont 所有字体族最后的回退，编译进二进制，保证任何工作目录下都有字可画
+	fallbackFont *truetype.Font
+)
+
+func init() {
+	fallbackFont = mustParseFont(goregular.TTF)
+	fontFamilies["go"] = &fontFamily{css: "sans-serif", fonts: []*truetype.Font{fallbackFont}}
+	fontFamilies["go-bold"] = &fontFamily{css: "sans-serif", weight: "bold", fonts: []*truetype.Font{mustParseFont(gobold.TTF)}}
+	fontFamilies["go-mono"] = &fontFamily{css: "monospace", fonts: []*truetype.Font{mustParseFont(gomono.TTF)}}
+}
+
+func mustParseFont(ttf []byte) *truetype.Font {
+	f, err := truetype.Parse(ttf)
+	if err != nil {
+		panic(fmt.Sprintf("parse embedded font: %v", err))
+	}
+	return f
+}
+
+// RegisterFontFamily registers name with the given TTF files in fallback order.
+func RegisterFontFamily(name, css string, ttfs ...[]byte) error {
+	if len(ttfs) == 0 {
+		return fmt.Errorf("font family %q: no fonts", name)
+	}
+	fam := &fontFamily{css: css}
+	for i, ttf := range ttfs {
+		f, err := truetype.Parse(ttf)
+		if err != nil {
+			return fmt.Errorf("font family %q: font %d: %w", name, i, err)
+		}
+		fam.fonts = append(fam.fonts, f)
+	}
+	fontMu.Lock()
+	fontFamilies[name] = fam
+	fontMu.Unlock()
+	return nil
+}
+
+// RegisterFontFile 把磁盘上的 TTF 注册成以文件路径命名的字体族，返回族名
+func RegisterFontFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return path, RegisterFontFamily(path, "sans-serif", data)
+}
+
+// CheckFontFamily returns an error if name is not registered; empty means DefaultFontFamily.
+func CheckFontFamily(name string) error {
+	if name == "" {
+		name = DefaultFontFamily
+	}
+	fontMu.RLock()
+	defer fontMu.RUnlock()
+	if _, ok := fontFamilies[name]; ok {
+		return nil
+	}
+	names := make([]string, 0, len(fontFamilies))
+	for n := range fontFamilies {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("unknown font family %q (available: %s)", name, strings.Join(names, ", "))
+}
+
+// lookupFontFamily 未注册的名字回退到 DefaultFontFamily，再不行用内置 go
+func lookupFontFamily(name string) *fontFamily {
+	fontMu.RLock()
+	defer fontMu.RUnlock()
+	for _, n := range []string{name, DefaultFontFamily, "go"} {
+		if fam, ok := fontFamilies[n]; ok {
+			return fam
+		}
+	}
+	return &fontFamily{css: "sans-serif", fonts: []*truetype.Font{fallbackFont}}
+}
+
+// NewFontFace 新建指定字体族、字号的 face。truetype face 带字形缓存，Glyph 返回的字形 mask
+// 是 face 内部的缓冲区，下一次调用就会被覆盖，所以 face 不能在 goroutine 之间共用，
+// 也不能只在调用期间加锁；重复使用请通过 faceCache，由单个渲染器独占
+func NewFontFace(family string, points float64) font.Face {
+	fam := lookupFontFamily(family)
+	fonts := make([]*truetype.Font, 0, len(fam.fonts)+1)
+	fonts = append(append(fonts, fam.fonts...), fallbackFont)
+	ff := &fallbackFace{}
+	for _, f := range fonts {
+		ff.fonts = append(ff.fonts, f)
+		ff.faces = append(ff.faces, truetype.NewFace(f, &truetype.Options{Size: points}))
+	}
+	return ff
+}
+
+type faceKey struct {
+	family string
+	points float64
+}
+
+// faceCache 一个渲染器自己的 face 缓存：绘制每个原子标签都要切换几次字号，
+// 每次新建 truetype face 开销很大。渲染器只在一个请求里使用，缓存不加锁
+type faceCache map[faceKey]font.Face
+
+func (c faceCache) face(family string, points float64) font.Face {
+	key := faceKey{family, points}
+	if f, ok := c[key]; ok {
+		return f
+	}
+	f := NewFontFace(family, points)
+	c[key] = f
+	return f
+}
+
+// fallbackFace 按顺序为每个字符挑选第一个含该字形的字体
+type fallbackFace struct {
+	fonts []*truetype.Font
+	faces []font.Face
+}
+
+func (f *fallbackFace) pick(r rune) int {
+	for i, ft := range f.fonts {
+		if ft.Index(r) != 0 {
+			return i
+		}
+	}
+	return 0 // 都没有就用主字体的 .notdef
+}
+
+func (f *fallbackFace) Close() error {
+	for _, face := range f.faces {
+		face.Close()
+	}
+	return nil
+}
+
+func (f *fallbackFace) Glyph(dot fixed.Point26_6, r rune) (image.Rectangle, image.Image, image.Point, fixed.Int26_6, bool) {
+	return f.faces[f.pick(r)].Glyph(dot, r)
+}
+
+func (f *fallbackFace) GlyphBounds(r rune) (fixed.Rectangle26_6, fixed.Int26_6, bool) {
+	return f.faces[f.pick(r)].GlyphBounds(r)
+}
+
+func (f *fallbackFace) GlyphAdvance(r rune) (fixed.Int26_6, bool) {
+	return f.faces[f.pick(r)].GlyphAdvance(r)
+}
+
+// Kern 只在两个字符来自同一字体时生效
+func (f *fallbackFace) Kern(r0, r1 rune) fixed.Int26_6 {
+	i := f.pick(r0)
+	if i != f.pick(r1) {
+		return 0
+	}
+	return f.faces[i].Kern(r0, r1)
+}
+
+func (f *fallbackFace) Metrics() font.Metrics {
+	return f.faces[0].Metrics()
+}
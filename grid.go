@@ -0,0 +1,154 @@
+// File: grid.go
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+)
+
+// 格子标签方案
+const (
+	LabelAlnum    = "alnum"    // 列字母 + 行号：A1、B2…，超过 26 列为 AA、AB…
+	LabelNumber   = "number"   // 按行从左到右编号 1..N
+	LabelShuffled = "shuffled" // 1..N 随机打乱
+)
+
+// maxGridSide 单边格子数上限，防止请求参数把画布切得过碎
+const maxGridSide = 40
+
+// GridSpec 网格设置，与答案数量无关；零值表示按答案数自动、正方形、A1 标签
+type GridSpec struct {
+	Cols, Rows int     // 固定列数、行数，任一为 0 表示自动
+	Aspect     float64 // 自动时的列/行比例，0 按 1
+	MinCells   int     // 自动时至少多少格，0 表示等于答案数
+	Labels     string  // 标签方案，空字符串为 LabelAlnum
+}
+
+// DefaultGridSpec 站点默认网格设置
+var DefaultGridSpec = GridSpec{}
+
+// Validate checks ranges and the label scheme.
+func (s GridSpec) Validate() error {
+	if s.Cols < 0 || s.Rows < 0 || s.Cols > maxGridSide || s.Rows > maxGridSide {
+		return fmt.Errorf("grid size must be within 0..%d", maxGridSide)
+	}
+	if s.Aspect < 0 || s.Aspect > 10 {
+		return fmt.Errorf("grid aspect must be within 0..10")
+	}
+	if s.MinCells < 0 || s.MinCells > maxGridSide*maxGridSide {
+		return fmt.Errorf("grid cells must be within 0..%d", maxGridSide*maxGridSide)
+	}
+	switch s.Labels {
+	case "", LabelAlnum, LabelNumber, LabelShuffled:
+	default:
+		return fmt.Errorf("unknown grid label scheme %q", s.Labels)
+	}
+	return nil
+}
+
+// Fits 固定尺寸的网格装不下 answers 个答案时返回错误；自动尺寸总能装下
+func (s GridSpec) Fits(answers int) error {
+	if s.Cols > 0 && s.Rows > 0 && s.Cols*s.Rows < answers {
+		return fmt.Errorf("a %dx%d grid cannot hold %d answers", s.Cols, s.Rows, answers)
+	}
+	return nil
+}
+
+// candidates 依次尝试的 (cols, rows)。固定尺寸只有一个候选；自动时从最紧凑的网格开始逐步加密
+func (s GridSpec) candidates(answers int) [][2]int {
+	if s.Cols > 0 && s.Rows > 0 {
+		return [][2]int{{s.Cols, s.Rows}}
+	}
+	n := answers
+	if s.MinCells > n {
+		n = s.MinCells
+	}
+	// 只固定一边时另一边按格子数推算，再逐步加密
+	if s.Cols > 0 || s.Rows > 0 {
+		fixed := s.Cols + s.Rows
+		other := (n + fixed - 1) / fixed
+		var out [][2]int
+		for d := 0; d < 3 && other+d <= maxGridSide; d++ {
+			if s.Cols > 0 {
+				out = append(out, [2]int{fixed, other + d})
+			} else {
+				out = append(out, [2]int{other + d, fixed})
+			}
+		}
+		return out
+	}
+	aspect := s.Aspect
+	if aspect == 0 {
+		aspect = 1
+	}
+	cols, rows := AutoGridAspect(n, aspect)
+	var out [][2]int
+	for _, d := range [][2]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}, {2, 1}, {1, 2}, {2, 2}} {
+		c, r := cols+d[0], rows+d[1]
+		if c <= maxGridSide && r <= maxGridSide {
+			out = append(out, [2]int{c, r})
+		}
+	}
+	return out
+}
+
+// columnName 0→A, 25→Z, 26→AA …（电子表格式列名）
+func columnName(i int) string {
+	name := ""
+	for i >= 0 {
+		name = string(rune('A'+i%26)) + name
+		i = i/26 - 1
+	}
+	return name
+}
+
+// GridCellLabels 生成每个格子的标签，顺序与 regions 一致：列优先（A1、A2…B1…）
+func GridCellLabels(cols, rows int, scheme string, rng *rand.Rand) ([]string, error) {
+	labels := make([]string, 0, cols*rows)
+	switch scheme {
+	case "", LabelAlnum:
+		for i := 0; i < cols; i++ {
+			for j := 0; j < rows; j++ {
+				labels = append(labels, columnName(i)+strconv.Itoa(j+1))
+			}
+		}
+	case LabelNumber, LabelShuffled:
+		nums := make([]int, cols*rows)
+		for k := range nums {
+			nums[k] = k + 1
+		}
+		if scheme == LabelShuffled {
+			rng.Shuffle(len(nums), func(a, b int) { nums[a], nums[b] = nums[b], nums[a] })
+		}
+		// 编号按阅读顺序（行优先），存储仍按列优先
+		for i := 0; i < cols; i++ {
+			for j := 0; j < rows; j++ {
+				labels = append(labels, strconv.Itoa(nums[j*cols+i]))
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown grid label scheme %q", scheme)
+	}
+	return labels, nil
+}
+
+// CellLabel returns the label of cell (col, row), defaulting to A1-style.
+func (cfg *MoleculeRenderConfig) CellLabel(col, row int) string {
+	if k := col*cfg.GridCountY + row; k < len(cfg.CellLabels) {
+		return cfg.CellLabels[k]
+	}
+	return columnName(col) + strconv.Itoa(row+1)
+}
+
+// Layout returns the grid as rows of labels for StartResponse.
+func (cfg *MoleculeRenderConfig) Layout() *GridLayout {
+	l := &GridLayout{Cols: cfg.GridCountX, Rows: cfg.GridCountY, Labels: make([][]string, cfg.GridCountY)}
+	for j := 0; j < cfg.GridCountY; j++ {
+		l.Labels[j] = make([]string, cfg.GridCountX)
+		for i := 0; i < cfg.GridCountX; i++ {
+			l.Labels[j][i] = cfg.CellLabel(i, j)
+		}
+	}
+	return l
+}
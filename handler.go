@@ -2,23 +2,55 @@
 package main
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"log"
+	"math/rand"
 	"net/http"
 	"os"
 	"sort"
+	"strconv"
 	"strings"
-	"sync"
+	"time"
 )
 
-var (
-	mu         sync.Mutex
-	challenges = make(map[string]Challenge)
+// 单个分子手性分析的时间与步数上限
+const (
+	chiralAnalysisTimeout = 2 * time.Second
+	chiralAnalysisSteps   = 5_000_000
 )
 
+// Challenge holds data for a captcha challenge
+type Challenge struct {
+	Mode    string   // ModeGrid、ModeClick、ModeTiles、ModeRS 或 Mode3D
+	Regions []string // 所有可选区域，比如 ["A1","A2",...]；R/S 模式为手性中心编号
+	Answers []string // 正确答案区域列表；R/S 模式为按编号排列的 "R"/"S"
+
+	// 点击模式与 3D 模式：手性原子的像素坐标与容差半径
+	Points []Point
+	Radius float64
+
+	// 3D 模式：观察角度，按倍率重绘时沿用
+	View *BallStickConfig
+
+	// 切片模式：切片 ID → PNG；Regions/Answers 为切片 ID
+	Tiles map[string][]byte
+
+	// 过期时间（由存储在 Put 时填写，放回存储时沿用）与已答错次数
+	Expires  time.Time
+	Attempts int
+
+	// 管理接口重绘用：变换后的分子、渲染配置、手性中心（1-based）及其 CIP 标记
+	Mol    *Molecule
+	Render *MoleculeRenderConfig
+	Chiral []int
+	CIP    map[int]string
+}
+
 func ParseSDFMulti(path string) ([]*Molecule, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -42,76 +74,349 @@ func ParseSDFMulti(path string) ([]*Molecule, error) {
 }
 
 func handleStart(w http.ResponseWriter, r *http.Request) {
-	// 尝试多次，确保至少有 3 个手性碳
+	// 出题要读 SDF、做手性分析和绘图，按客户端限流；答错过多被锁定的客户端也不再出题
+	if !limitClient(w, ClientIP(r), startLimiter) {
+		return
+	}
+
+	// ?format=svg 返回矢量图，默认 PNG
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = FormatPNG
+	}
+	if format != FormatPNG && format != FormatSVG {
+		http.Error(w, "unsupported format: "+format, http.StatusBadRequest)
+		return
+	}
+	// ?theme=dark 等，缺省为站点默认主题
+	theme, err := LookupTheme(r.URL.Query().Get("theme"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// ?aromatic=circle 芳香环画内圆，?aromatic=kekule 画单双键，缺省为站点默认
+	aromaticCircles, err := ParseAromaticStyle(r.URL.Query().Get("aromatic"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// ?mode=click 点击原子作答，不画网格；?mode=tiles 切片作答，只支持 PNG；
+	// ?mode=rs 画成 Fischer 投影，逐个回答手性中心是 R 还是 S；?mode=3d 随机角度的球棍模型，只支持 PNG
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = ModeGrid
+	}
+	if mode != ModeGrid && mode != ModeClick && mode != ModeTiles && mode != ModeRS && mode != Mode3D {
+		http.Error(w, "unsupported mode: "+mode, http.StatusBadRequest)
+		return
+	}
+	if (mode == ModeTiles || mode == Mode3D) && format != FormatPNG {
+		http.Error(w, mode+" mode only supports png", http.StatusBadRequest)
+		return
+	}
+	// 切片存放在服务端，无状态存储下不可用
+	if mode == ModeTiles && statelessStore() {
+		http.Error(w, "tiles mode needs a server-side challenge store", http.StatusBadRequest)
+		return
+	}
+
+	// 星号策略：?markers=none|sp3|decoy|answers 或 ?difficulty=easy|normal|hard，缺省用站点设置
+	markers, err := ResolveMarkerPolicy(r.URL.Query().Get("markers"), r.URL.Query().Get("difficulty"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// ?view=x,y,z 3D 构象投影到平面时的观察方向（从分子指向观察者），缺省取分子最扁的方向
+	var view *Vec3
+	if v := r.URL.Query().Get("view"); v != "" {
+		eye, err := ParseViewDirection(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		view = &eye
+	}
+
+	// 尝试多次，确保至少有 3 个手性碳，且能无歧义地放进网格。
+	// R/S 题需要带楔形键或 3D 坐标、含 MinFischerCentres 个手性中心的开链分子；3D 题需要 3D 构象。这两种多试几次
+	minCentres, attempts := 3, 5
+	switch mode {
+	case ModeRS:
+		minCentres, attempts = MinFischerCentres, 20
+	case Mode3D:
+		attempts = 20
+	}
+
+	// 网格：?cols=&rows=&aspect=&cells=&labels=，缺省用站点设置。
+	// 只有网格和切片题用得到网格，固定尺寸装不下答案时在读分子之前就拒绝
+	gridAnswers := 0
+	if mode == ModeGrid || mode == ModeTiles {
+		gridAnswers = minCentres
+	}
+	grid, err := parseGridSpec(r, DefaultGridSpec, gridAnswers)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// ?scale=2|3 返回高密度图片，格子与坐标仍按 1x（响应中的 width/height）计算
+	scale, err := parseScale(r.URL.Query().Get("scale"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
 	var mol *Molecule
 	var chiral []int
-	var err error
-	for attempt := 0; attempt < 5; attempt++ {
+	var tf *ChallengeTransform
+	var renderCfg *MoleculeRenderConfig
+	var cip map[int]string
+	var rsLabels []string
+	var view3D *BallStickConfig
+	var points3D []Point
+	var radius3D float64
+	for attempt := 0; attempt < attempts; attempt++ {
 		mol, err = pickRandomMoleculeFromIndexed("output.sdf", "output.index")
 		if err != nil {
 			fmt.Println("err:", err)
 			continue
 		}
+		if mode == Mode3D && !mol.Is3D() {
+			err = ErrNo3DCoordinates
+			continue
+		}
 		Hydrogenate(mol)
-		chiral = GetMoleculeChiralCarbons(mol)
+		ctx, cancel := context.WithTimeout(r.Context(), chiralAnalysisTimeout)
+		chiral, err = GetMoleculeChiralCarbonsCtx(ctx, mol, chiralAnalysisSteps)
+		// CIP 标记只给管理接口用，与手性分析共用超时；镜像会翻转楔形键的含义，要在变换前算
+		cip = nil
+		if err == nil && len(chiral) >= minCentres {
+			cip = debugCIPLabels(ctx, mol, chiral)
+		}
+		cancel()
+		if err != nil {
+			fmt.Println("err:", err)
+			continue
+		}
 		fmt.Println("Result:", chiral)
-		if len(chiral) >= 3 {
+		if len(chiral) < minCentres {
+			continue
+		}
+
+		// 3D 题：换几个随机角度，直到每个手性原子都没被更近的球挡住
+		if mode == Mode3D {
+			view3D, points3D = nil, nil
+			for try := 0; try < 8 && view3D == nil; try++ {
+				view3D = RandomBallStickConfig(rng)
+				if points3D, radius3D, err = visibleCentres(mol, view3D, chiral); err != nil {
+					view3D = nil
+				}
+			}
+			if view3D == nil {
+				fmt.Println("err:", err)
+				continue
+			}
+			break
+		}
+
+		// R/S 题：重排成 Fischer 投影，左右顺序本身就是答案，不做缩写和几何变换
+		if mode == ModeRS {
+			fm, centres, labels, ferr := FischerProjection(mol, chiral)
+			if ferr != nil {
+				err = ferr
+				fmt.Println("err:", err)
+				continue
+			}
+			mol, chiral, rsLabels = fm, centres, labels
+			cip = make(map[int]string, len(centres))
+			for i, idx := range centres {
+				cip[idx] = labels[i]
+			}
+			if EnableAntiSolver {
+				tf = RandomTransform(rng)
+			}
+			if renderCfg, err = FischerRenderConfig(mol, FischerRenderSizing); err != nil {
+				fmt.Println("err:", err)
+				continue
+			}
 			break
 		}
+
+		// 3D 构象先投影成平面图，Z 保留为深度
+		if mol.Is3D() {
+			eye := mol.FlattestView()
+			if view != nil {
+				eye = *view
+			}
+			mol = mol.ProjectTo2D(eye)
+		}
+
+		// 随机旋转/镜像/抖动/扭曲，之后的答案格子都基于变换后的坐标
+		// 大分子把不含答案的常见基团缩写成标签，之后的原子下标都是缩写后的
+		if EnableAbbreviations {
+			var remap []int
+			mol, remap = Abbreviate(mol, chiral)
+			chiral = RemapAtoms(chiral, remap)
+			abbrCIP := make(map[int]string, len(cip))
+			for idx, label := range cip {
+				abbrCIP[remap[idx-1]+1] = label
+			}
+			cip = abbrCIP
+		}
+		if EnableAntiSolver {
+			tf = RandomTransform(rng)
+			mol = tf.Apply(mol)
+		}
+
+		// 3) 网格 + 4) 渲染配置：保证每个手性碳离格线有余量且各占一格；点击模式不需要网格
+		if mode == ModeClick {
+			renderCfg, err = SizedRenderConfig(mol, DefaultRenderSizing, 1, 1)
+			if err == nil {
+				renderCfg.DrawGrid = false
+			}
+		} else {
+			renderCfg, err = PlaceAnswerGrid(mol, chiral, DefaultRenderSizing, grid, rng)
+		}
+		if err != nil {
+			fmt.Println("err:", err)
+			continue
+		}
+		break
 	}
-	if len(chiral) < 3 {
+	if len(chiral) < minCentres {
 		http.Error(w, "not enough chiral carbons, try again", http.StatusInternalServerError)
 		//fmt.Println("Result:", chiral)
 		//fmt.Println(chiral)
 		return
 	}
-
-	// 3) 自动网格
-	cols, rows := AutoGrid(len(chiral))
-
-	// 4) 渲染配置（动态计算）
-	renderCfg, err := CalculateRenderConfig(mol, 600, cols, rows)
-	if err != nil {
-		http.Error(w, "failed to calculate render config: "+err.Error(), http.StatusInternalServerError)
+	if mode == Mode3D {
+		if view3D == nil {
+			http.Error(w, "no 3D conformer with visible chiral centres, try again", http.StatusInternalServerError)
+			return
+		}
+		view3D.Theme = theme
+		img3D := *view3D
+		img3D.Scale = scale
+		molBytes, _, err := RenderBallStick(mol, &img3D)
+		if err != nil {
+			http.Error(w, "failed to draw molecule: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		id, expires, ok := issueChallenge(w, Challenge{Mode: Mode3D, Points: points3D, Radius: radius3D, View: view3D, Mol: mol, Chiral: chiral, CIP: cip})
+		if !ok {
+			return
+		}
+		log.Printf("Challenge %s Correct Points: %v", id, points3D)
+		writeStartResponse(w, StartResponse{
+			UUID:      id,
+			ExpiresAt: expires,
+			Mode:      Mode3D,
+			Image:     "data:" + ImageMIMEType(FormatPNG) + ";base64," + base64.StdEncoding.EncodeToString(molBytes),
+			Scale:     scale,
+			Width:     view3D.Width,
+			Height:    view3D.Height,
+			Regions:   []string{},
+			Variants:  imageVariants(id),
+		})
 		return
 	}
-	// 标记手性碳
-	for _, idx := range chiral {
-		renderCfg.ShownChiral[idx] = true
+	if mode == ModeRS && rsLabels == nil {
+		http.Error(w, "no molecule suitable for a Fischer projection, try again", http.StatusInternalServerError)
+		return
+	}
+	if renderCfg == nil {
+		http.Error(w, "failed to place answer atoms on grid, try again", http.StatusInternalServerError)
+		return
+	}
+	renderCfg.Format = format
+	renderCfg.AromaticCircles = aromaticCircles
+	if tf != nil {
+		tf.Configure(renderCfg)
+	}
+	renderCfg.Theme = theme
+	// 切片上的格子标签会暴露位置，不画棋盘格
+	if mode == ModeTiles {
+		renderCfg.DrawGrid = false
+	}
+	// 星号：按策略标记，真正的手性中心混在干扰项或全部 sp3 碳中；R/S 题改为给手性中心编号
+	var rsRegions []string
+	if mode == ModeRS {
+		renderCfg.CentreLabels = make(map[int]string, len(chiral))
+		for i, idx := range chiral {
+			n := strconv.Itoa(i + 1)
+			renderCfg.CentreLabels[idx] = n
+			rsRegions = append(rsRegions, n)
+		}
+	} else if renderCfg.ShownChiral, err = MarkedAtoms(mol, chiral, markers, rng); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	// 5) 绘制分子并拿到 regions
-	molBytes, regions, err := RenderMoleculeImage(mol, renderCfg)
+	// 5) 绘制分子并拿到 regions；高倍率只影响输出像素
+	imgCfg := renderCfg
+	if scale > 1 {
+		imgCfg = renderCfg.Scaled(scale)
+	}
+	molBytes, regions, err := RenderMoleculeImage(mol, imgCfg)
 	if err != nil {
 		http.Error(w, "failed to draw molecule: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// 6) 计算答案：用同一个 renderCfg
-	cellW := float64(renderCfg.Width) / float64(renderCfg.GridCountX)
-	cellH := float64(renderCfg.Height) / float64(renderCfg.GridCountY)
+	// 6) 计算答案：用同一个 renderCfg；分子与渲染配置留给管理接口重绘
+	chal := Challenge{Mode: mode, Mol: mol, Render: renderCfg, Chiral: chiral, CIP: cip}
+	if mode == ModeClick {
+		points := make([]Point, len(chiral))
+		for i, idx := range chiral {
+			points[i] = AtomPixel(mol, renderCfg, idx)
+		}
+		chal.Points, chal.Radius = points, ClickRadius(mol, renderCfg)
+		id, expires, ok := issueChallenge(w, chal)
+		if !ok {
+			return
+		}
+		log.Printf("Challenge %s Correct Points: %v", id, points)
+		writeStartResponse(w, StartResponse{
+			UUID:      id,
+			ExpiresAt: expires,
+			Mode:      ModeClick,
+			Image:     "data:" + ImageMIMEType(format) + ";base64," + base64.StdEncoding.EncodeToString(molBytes),
+			Scale:     scale,
+			Width:     renderCfg.Width,
+			Height:    renderCfg.Height,
+			Regions:   []string{},
+			Variants:  imageVariants(id),
+		})
+		return
+	}
+
+	if mode == ModeRS {
+		chal.Regions, chal.Answers = rsRegions, rsLabels
+		id, expires, ok := issueChallenge(w, chal)
+		if !ok {
+			return
+		}
+		log.Printf("Challenge %s Correct Answers: %v", id, rsLabels)
+		writeStartResponse(w, StartResponse{
+			UUID:      id,
+			ExpiresAt: expires,
+			Mode:      ModeRS,
+			Image:     "data:" + ImageMIMEType(format) + ";base64," + base64.StdEncoding.EncodeToString(molBytes),
+			Scale:     scale,
+			Width:     renderCfg.Width,
+			Height:    renderCfg.Height,
+			Regions:   rsRegions,
+			Variants:  imageVariants(id),
+		})
+		return
+	}
 
 	answersSet := make(map[string]struct{}, len(chiral))
 	for _, idx := range chiral {
-		a := mol.Atoms[idx-1]
-		// 原子中心在画布上的像素坐标
-		px := renderCfg.FontSize + renderCfg.ScaleFactor*(a.X-mol.MinX())
-		py := float64(renderCfg.Height) - renderCfg.FontSize - renderCfg.ScaleFactor*(a.Y-mol.MinY())
-
-		col := int(px / cellW)
-		row := int(py / cellH)
-		// 边界保护
-		if col < 0 {
-			col = 0
-		} else if col >= renderCfg.GridCountX {
-			col = renderCfg.GridCountX - 1
-		}
-		if row < 0 {
-			row = 0
-		} else if row >= renderCfg.GridCountY {
-			row = renderCfg.GridCountY - 1
-		}
-		label := fmt.Sprintf("%c%d", 'A'+col, row+1)
+		col, row, _ := AtomCell(mol, renderCfg, idx)
+		label := renderCfg.CellLabel(col, row)
 		answersSet[label] = struct{}{}
 	}
 
@@ -123,50 +428,291 @@ func handleStart(w http.ResponseWriter, r *http.Request) {
 	sort.Strings(answers)
 
 	// 8) 存储并返回
-	id := uuid.New().String()
+	if mode == ModeTiles {
+		tiles, err := CutTiles(molBytes, imgCfg)
+		if err != nil {
+			http.Error(w, "failed to cut tiles: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		ts := NewTileSet(tiles, regions, rng)
+		tileAnswers := make([]string, len(answers))
+		for i, a := range answers {
+			tileAnswers[i] = ts.Cells[a]
+		}
+		sort.Strings(tileAnswers)
+		chal.Regions, chal.Answers, chal.Tiles = ts.Order, tileAnswers, ts.Images
+		id, expires, ok := issueChallenge(w, chal)
+		if !ok {
+			return
+		}
+		log.Printf("Challenge %s Correct Answers: %v (tiles %v)", id, answers, tileAnswers)
+
+		// 按打乱后的顺序排成 cols×rows
+		layout := &GridLayout{Cols: renderCfg.GridCountX, Rows: renderCfg.GridCountY, Labels: make([][]string, renderCfg.GridCountY)}
+		urls := make([]string, len(ts.Order))
+		for k, tid := range ts.Order {
+			row := k / layout.Cols
+			layout.Labels[row] = append(layout.Labels[row], tid)
+			urls[k] = "/api/challenge/tile?uuid=" + id + "&tile=" + tid
+		}
+		writeStartResponse(w, StartResponse{
+			UUID:      id,
+			ExpiresAt: expires,
+			Mode:      ModeTiles,
+			Scale:     scale,
+			Width:     renderCfg.Width,
+			Height:    renderCfg.Height,
+			Regions:   ts.Order,
+			Layout:    layout,
+			Tiles:     urls,
+		})
+		return
+	}
+	chal.Regions, chal.Answers = regions, answers
+	id, expires, ok := issueChallenge(w, chal)
+	if !ok {
+		return
+	}
 	log.Printf("Challenge %s Correct Answers: %v", id, answers)
-	mu.Lock()
-	challenges[id] = Challenge{Regions: regions, Answers: answers}
-	mu.Unlock()
 
-	rsp := StartResponse{
-		UUID:    id,
-		Image:   "data:image/png;base64," + base64.StdEncoding.EncodeToString(molBytes),
-		Regions: regions,
+	writeStartResponse(w, StartResponse{
+		UUID:      id,
+		ExpiresAt: expires,
+		Mode:      ModeGrid,
+		Image:     "data:" + ImageMIMEType(format) + ";base64," + base64.StdEncoding.EncodeToString(molBytes),
+		Scale:     scale,
+		Width:     renderCfg.Width,
+		Height:    renderCfg.Height,
+		Regions:   regions,
+		Layout:    renderCfg.Layout(),
+		Variants:  imageVariants(id),
+	})
+}
+
+// issueChallenge 保存题目，返回题目 ID 与过期时间。无状态存储由存储自己生成 ID（封装了答案的令牌），
+// 其余存储用随机 UUID。失败时写出 500，返回 false
+func issueChallenge(w http.ResponseWriter, chal Challenge) (string, time.Time, bool) {
+	var id string
+	var expires time.Time
+	var err error
+	if is, ok := challenges.(ChallengeIssuer); ok {
+		id, expires, err = is.Issue(chal)
+	} else {
+		id = uuid.New().String()
+		expires, err = challenges.Put(id, chal)
+	}
+	if err != nil {
+		http.Error(w, "failed to store challenge: "+err.Error(), http.StatusInternalServerError)
+		return "", time.Time{}, false
+	}
+	return id, expires, true
+}
+
+// getChallenge 只读取题目（图片、切片、管理接口）。存储故障记日志，按找不到处理
+func getChallenge(id string) (Challenge, bool) {
+	chal, err := challenges.Get(id)
+	if err != nil && !errors.Is(err, ErrChallengeNotFound) {
+		log.Printf("load challenge %s: %v", id, err)
 	}
+	return chal, err == nil
+}
+
+func writeStartResponse(w http.ResponseWriter, rsp StartResponse) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(rsp)
 }
 
+// parseScale 解析输出倍率，空字符串为 1
+func parseScale(v string) (int, error) {
+	if v == "" {
+		return 1, nil
+	}
+	s, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid scale: %q", v)
+	}
+	return s, CheckRenderScale(s)
+}
+
+// imageVariants 同一题目 1x/2x/3x 图片的地址，供前端 srcset 使用；无状态存储无法重绘，返回 nil
+func imageVariants(id string) map[string]string {
+	if statelessStore() {
+		return nil
+	}
+	v := make(map[string]string, maxRenderScale)
+	for s := 1; s <= maxRenderScale; s++ {
+		v[strconv.Itoa(s)+"x"] = "/api/challenge/image?uuid=" + id + "&scale=" + strconv.Itoa(s)
+	}
+	return v
+}
+
+// handleImage 按指定倍率重新绘制题目图片。切片模式不提供整图
+func handleImage(w http.ResponseWriter, r *http.Request) {
+	// 每次都按倍率整图重绘，与出题分开限流
+	if !limitClient(w, ClientIP(r), imageLimiter) {
+		return
+	}
+	q := r.URL.Query()
+	scale, err := parseScale(q.Get("scale"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	chal, ok := getChallenge(q.Get("uuid"))
+	if ok && chal.View != nil {
+		view := *chal.View
+		view.Scale = scale
+		img, _, err := RenderBallStick(chal.Mol, &view)
+		if err != nil {
+			http.Error(w, "failed to draw molecule: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", ImageMIMEType(FormatPNG))
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(img)
+		return
+	}
+	if !ok || chal.Mode == ModeTiles || chal.Render == nil {
+		http.Error(w, "uuid not found", http.StatusNotFound)
+		return
+	}
+	cfg := chal.Render.Scaled(scale)
+	img, _, err := RenderMoleculeImage(chal.Mol, cfg)
+	if err != nil {
+		http.Error(w, "failed to draw molecule: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", ImageMIMEType(cfg.Format))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(img)
+}
+
+// handleTile 返回切片模式下的单张切片
+func handleTile(w http.ResponseWriter, r *http.Request) {
+	if !limitClient(w, ClientIP(r), tileLimiter) {
+		return
+	}
+	q := r.URL.Query()
+	chal, ok := getChallenge(q.Get("uuid"))
+	tile, found := chal.Tiles[q.Get("tile")]
+	if !ok || !found {
+		http.Error(w, "tile not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", ImageMIMEType(FormatPNG))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(tile)
+}
+
+// parseGridSpec 用查询参数覆盖 def 中的网格设置，并检查固定尺寸能否装下 minAnswers 个答案
+func parseGridSpec(r *http.Request, def GridSpec, minAnswers int) (GridSpec, error) {
+	q := r.URL.Query()
+	spec := def
+	ints := map[string]*int{"cols": &spec.Cols, "rows": &spec.Rows, "cells": &spec.MinCells}
+	for key, dst := range ints {
+		if v := q.Get(key); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return spec, fmt.Errorf("invalid %s: %q", key, v)
+			}
+			*dst = n
+		}
+	}
+	if v := q.Get("aspect"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return spec, fmt.Errorf("invalid aspect: %q", v)
+		}
+		spec.Aspect = f
+	}
+	if v := q.Get("labels"); v != "" {
+		spec.Labels = v
+	}
+	if err := spec.Validate(); err != nil {
+		return spec, err
+	}
+	return spec, spec.Fits(minAnswers)
+}
+
 func handleVerify(w http.ResponseWriter, r *http.Request) {
+	ip := ClientIP(r)
+	if !limitClient(w, ip, verifyLimiter) {
+		return
+	}
 	var req VerifyRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "invalid json", http.StatusBadRequest)
 		return
 	}
 
-	mu.Lock()
-	chal, ok := challenges[req.UUID]
-	mu.Unlock()
-	if !ok {
-		http.Error(w, "uuid not found", http.StatusNotFound)
+	// 取出即删除：答对或次数用完后题目失效（默认只能验证一次）
+	chal, err := challenges.Consume(req.UUID)
+	if errors.Is(err, ErrChallengeNotFound) {
+		http.Error(w, "uuid not found or expired", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, ErrStoreFull) {
+		log.Printf("verify %s: %v", req.UUID, err)
+		http.Error(w, "server busy, try again later", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, "failed to load challenge: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// 对比答案
+	if !checkAnswer(chal, req) {
+		// 还有机会时放回存储，过期时间不变；无状态令牌无法更新，只能验证一次。
+		// R/S 题每个中心只有两种答案，重试等于让人逐个试出来，答错即失效
+		chal.Attempts++
+		left := 0
+		if chal.Attempts < MaxAttempts && chal.Mode != ModeRS && !statelessStore() {
+			if _, err := challenges.Put(req.UUID, chal); err != nil {
+				log.Printf("put back challenge %s: %v", req.UUID, err)
+			} else {
+				left = MaxAttempts - chal.Attempts
+			}
+		}
+		if EnableRateLimit && lockout.Fail(ip, time.Now()) {
+			log.Printf("client %s locked out for %v after repeated failures", ip, LockoutDuration)
+		}
+		json.NewEncoder(w).Encode(VerifyResponse{Success: false, Message: "验证失败", AttemptsLeft: left})
+		return
+	}
+	if EnableRateLimit {
+		lockout.Reset(ip)
+	}
+	json.NewEncoder(w).Encode(VerifyResponse{Success: true, Message: "验证通过"})
+}
+
+// checkAnswer 按题目模式对比答案
+func checkAnswer(chal Challenge, req VerifyRequest) bool {
+	if chal.Mode == ModeClick || chal.Mode == Mode3D {
+		return MatchClicks(chal.Points, req.Clicks, chal.Radius)
+	}
+	if chal.Mode == ModeRS {
+		// 按编号顺序逐个给出 R/S
+		if len(req.Selections) != len(chal.Answers) {
+			return false
+		}
+		for i, sel := range req.Selections {
+			if sel != chal.Answers[i] {
+				return false
+			}
+		}
+		return true
+	}
 	ansMap := make(map[string]bool, len(chal.Answers))
 	for _, a := range chal.Answers {
 		ansMap[a] = true
 	}
 	if len(req.Selections) != len(chal.Answers) {
-		json.NewEncoder(w).Encode(VerifyResponse{false, "验证失败"})
-		return
+		return false
 	}
 	for _, sel := range req.Selections {
 		if !ansMap[sel] {
-			json.NewEncoder(w).Encode(VerifyResponse{false, "验证失败"})
-			return
+			return false
 		}
 	}
-	json.NewEncoder(w).Encode(VerifyResponse{true, "验证通过"})
+	return true
 }
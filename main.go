@@ -2,14 +2,196 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func main() {
+	// 手性判断不区分同位素：CHIRAL_IGNORE_ISOTOPES=1，须与生成索引时的 -ignore-isotopes 一致
+	if os.Getenv("CHIRAL_IGNORE_ISOTOPES") == "1" {
+		DefaultIgnoreIsotopes = true
+	}
+
+	// 子命令：validate [-ignore-isotopes] <input.sdf> <report.tsv>，用 PubChem 立体计数标签校验 chiral.go
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		args := os.Args[2:]
+		if len(args) > 0 && args[0] == "-ignore-isotopes" {
+			DefaultIgnoreIsotopes = true
+			args = args[1:]
+		}
+		if len(args) != 2 {
+			fmt.Println("用法: startAuth validate [-ignore-isotopes] <input.sdf> <report.tsv>")
+			os.Exit(1)
+		}
+		stats, err := ValidateStereoCounts(args[0], args[1])
+		if err != nil {
+			fmt.Println("校验失败:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("共 %d 条记录，比较 %d 条，不一致 %d 条，含杂原子立体中心无法判定 %d 条，解析失败 %d 条\n",
+			stats.Total, stats.Checked, stats.Mismatch, stats.Hetero, stats.ParseFail)
+		if stats.Mismatch > 0 {
+			os.Exit(2)
+		}
+		return
+	}
+
+	// 站点默认配色，例如 CHIRAL_THEME=dark
+	if name := os.Getenv("CHIRAL_THEME"); name != "" {
+		if _, err := LookupTheme(name); err != nil {
+			log.Fatal(err)
+		}
+		DefaultThemeName = name
+	}
+
+	// 芳香环默认画法：CHIRAL_AROMATIC=circle 画内圆，kekule（默认）画单双键
+	if v := os.Getenv("CHIRAL_AROMATIC"); v != "" {
+		circles, err := ParseAromaticStyle(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+		DefaultAromaticCircles = circles
+	}
+
+	// 站点默认字体：内置字体族名（go、go-bold、go-mono）或 .ttf 文件路径
+	if name := os.Getenv("CHIRAL_FONT"); name != "" {
+		if strings.HasSuffix(strings.ToLower(name), ".ttf") {
+			var err error
+			if name, err = RegisterFontFile(name); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if err := CheckFontFamily(name); err != nil {
+			log.Fatal(err)
+		}
+		DefaultFontFamily = name
+	}
+
+	// 星号策略：CHIRAL_MARKERS=none|sp3|decoy|answers；
+	// 难度映射：CHIRAL_DIFFICULTY=easy=decoy,normal=sp3,hard=none
+	if p := os.Getenv("CHIRAL_MARKERS"); p != "" {
+		if err := CheckMarkerPolicy(p); err != nil {
+			log.Fatal(err)
+		}
+		DefaultMarkerPolicy = p
+	}
+	if s := os.Getenv("CHIRAL_DIFFICULTY"); s != "" {
+		m, err := ParseDifficultyMarkers(s)
+		if err != nil {
+			log.Fatal(err)
+		}
+		DifficultyMarkers = m
+	}
+
+	// CHIRAL_ABBREV=0 关闭基团缩写
+	if os.Getenv("CHIRAL_ABBREV") == "0" {
+		EnableAbbreviations = false
+	}
+
+	// CHIRAL_ANTISOLVER=0 关闭每题随机变换（调试用）
+	if os.Getenv("CHIRAL_ANTISOLVER") == "0" {
+		EnableAntiSolver = false
+	}
+
+	// 题目有效期与存储上限：CHIRAL_CHALLENGE_TTL=2m、CHIRAL_MAX_CHALLENGES=50000
+	if v := os.Getenv("CHIRAL_CHALLENGE_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			log.Fatalf("invalid CHIRAL_CHALLENGE_TTL: %q", v)
+		}
+		ChallengeTTL = d
+	}
+	if v := os.Getenv("CHIRAL_MAX_CHALLENGES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			log.Fatalf("invalid CHIRAL_MAX_CHALLENGES: %q", v)
+		}
+		MaxChallenges = n
+	}
+	// 存储后端：CHIRAL_STORE=memory（默认）|file|sealed，file 存放在 CHIRAL_STORE_DIR（默认 ./challenges），
+	// sealed 用 CHIRAL_SEAL_KEY 派生加密密钥，多实例须设置相同的值
+	storeDir := os.Getenv("CHIRAL_STORE_DIR")
+	if storeDir == "" {
+		storeDir = "challenges"
+	}
+	store, err := OpenChallengeStore(os.Getenv("CHIRAL_STORE"), storeDir, os.Getenv("CHIRAL_SEAL_KEY"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	challenges = store
+	go RunSweeper(challenges, SweepInterval)
+
+	// 每道题的验证次数：CHIRAL_MAX_ATTEMPTS=3（默认 1，答错即失效）
+	if v := os.Getenv("CHIRAL_MAX_ATTEMPTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			log.Fatalf("invalid CHIRAL_MAX_ATTEMPTS: %q", v)
+		}
+		MaxAttempts = n
+	}
+
+	// 按客户端限流：CHIRAL_RATE_LIMIT=0 关闭；CHIRAL_START_RATE=30/m、CHIRAL_VERIFY_RATE=60/m、
+	// CHIRAL_IMAGE_RATE=60/m、CHIRAL_TILE_RATE=600/m、CHIRAL_ADMIN_RATE=60/m；
+	// 答错锁定：CHIRAL_LOCKOUT_FAILURES=20（0 关闭）、CHIRAL_LOCKOUT_DURATION=15m；
+	// 反向代理：CHIRAL_TRUSTED_PROXIES=127.0.0.1,10.0.0.0/8，只信任这些地址转发的 X-Forwarded-For
+	if os.Getenv("CHIRAL_RATE_LIMIT") == "0" {
+		EnableRateLimit = false
+	}
+	rates := map[string]*Rate{
+		"CHIRAL_START_RATE":  &StartRate,
+		"CHIRAL_VERIFY_RATE": &VerifyRate,
+		"CHIRAL_IMAGE_RATE":  &ImageRate,
+		"CHIRAL_TILE_RATE":   &TileRate,
+		"CHIRAL_ADMIN_RATE":  &AdminRate,
+	}
+	for env, dst := range rates {
+		if v := os.Getenv(env); v != "" {
+			rate, err := ParseRate(v)
+			if err != nil {
+				log.Fatalf("%s: %v", env, err)
+			}
+			*dst = rate
+		}
+	}
+	if v := os.Getenv("CHIRAL_LOCKOUT_FAILURES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			log.Fatalf("invalid CHIRAL_LOCKOUT_FAILURES: %q", v)
+		}
+		LockoutFailures = n
+	}
+	if v := os.Getenv("CHIRAL_LOCKOUT_DURATION"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			log.Fatalf("invalid CHIRAL_LOCKOUT_DURATION: %q", v)
+		}
+		LockoutDuration = d
+	}
+	if TrustedProxies, err = ParseTrustedProxies(os.Getenv("CHIRAL_TRUSTED_PROXIES")); err != nil {
+		log.Fatal(err)
+	}
+	startLimiter = NewRateLimiter(StartRate)
+	verifyLimiter = NewRateLimiter(VerifyRate)
+	imageLimiter = NewRateLimiter(ImageRate)
+	tileLimiter = NewRateLimiter(TileRate)
+	adminLimiter = NewRateLimiter(AdminRate)
+	lockout = NewLockout(LockoutFailures, LockoutDuration)
+	go RunClientSweeper(SweepInterval)
+
+	// 管理接口令牌，未设置时 /api/admin/* 关闭
+	AdminToken = os.Getenv("CHIRAL_ADMIN_TOKEN")
+
 	http.Handle("/", http.FileServer(http.Dir("./static")))
 	http.HandleFunc("/api/challenge/verify", handleVerify)
 	http.HandleFunc("/api/challenge/start", handleStart)
+	http.HandleFunc("/api/challenge/tile", handleTile)
+	http.HandleFunc("/api/challenge/image", handleImage)
+	http.HandleFunc("/api/admin/challenge", handleAdminChallenge)
 
 	log.Println("Server listening on :28416")
 	log.Fatal(http.ListenAndServe(":28416", nil))
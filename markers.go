@@ -0,0 +1,146 @@
+// File: markers.go
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// 手性标记（星号）策略
+const (
+	MarkerNone    = "none"    // 不画星号
+	MarkerSP3     = "sp3"     // 所有 sp3 碳都画星号
+	MarkerDecoy   = "decoy"   // 真正的手性中心加上同样数量的非手性 sp3 碳作干扰
+	MarkerAnswers = "answers" // 只标真正的手性中心（旧行为，等于把答案画在图上，仅用于演示）
+)
+
+// DefaultMarkerPolicy 站点默认策略，main 中可由环境变量 CHIRAL_MARKERS 覆盖
+var DefaultMarkerPolicy = MarkerDecoy
+
+// DifficultyMarkers 难度 → 标记策略，请求 ?difficulty= 时使用；
+// main 中可由环境变量 CHIRAL_DIFFICULTY（如 easy=decoy,normal=sp3,hard=none）覆盖
+var DifficultyMarkers = map[string]string{
+	"easy":   MarkerDecoy,
+	"normal": MarkerSP3,
+	"hard":   MarkerNone,
+}
+
+// CheckMarkerPolicy reports whether p is a known marker policy.
+func CheckMarkerPolicy(p string) error {
+	switch p {
+	case MarkerNone, MarkerSP3, MarkerDecoy, MarkerAnswers:
+		return nil
+	}
+	return fmt.Errorf("unknown marker policy %q", p)
+}
+
+// ResolveMarkerPolicy 按优先级决定策略：显式 markers > difficulty 对应的策略 > 站点默认
+func ResolveMarkerPolicy(markers, difficulty string) (string, error) {
+	if markers != "" {
+		return markers, CheckMarkerPolicy(markers)
+	}
+	if difficulty != "" {
+		p, ok := DifficultyMarkers[difficulty]
+		if !ok {
+			return "", fmt.Errorf("unknown difficulty %q", difficulty)
+		}
+		return p, nil
+	}
+	return DefaultMarkerPolicy, nil
+}
+
+// ParseDifficultyMarkers 解析 "easy=decoy,normal=sp3,hard=none"
+func ParseDifficultyMarkers(s string) (map[string]string, error) {
+	out := make(map[string]string)
+	for _, kv := range strings.Split(s, ",") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" {
+			continue
+		}
+		name, policy, ok := strings.Cut(kv, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid difficulty entry %q", kv)
+		}
+		if err := CheckMarkerPolicy(policy); err != nil {
+			return nil, err
+		}
+		out[name] = policy
+	}
+	return out, nil
+}
+
+// isSP3Carbon 碳原子只有单键且连接数（含隐式氢）为 4
+func (m *Molecule) isSP3Carbon(c0 int) bool {
+	a := &m.Atoms[c0]
+	if a.Element != "C" {
+		return false
+	}
+	bonds := m.GetAtomDeclaredBonds(c0 + 1)
+	for _, b := range bonds {
+		if b.Order != 1 {
+			return false
+		}
+	}
+	return len(bonds)+a.HCount == 4
+}
+
+// heavyDegree 非氢邻居数
+func (m *Molecule) heavyDegree(c0 int) int {
+	n := 0
+	for _, b := range m.GetAtomDeclaredBonds(c0 + 1) {
+		other := b.From
+		if other == c0 {
+			other = b.To
+		}
+		if m.Atoms[other].Element != "H" {
+			n++
+		}
+	}
+	return n
+}
+
+// MarkedAtoms 按策略返回需要画星号的原子（1-based）。chiral 为真正的手性中心；
+// decoy 策略优先挑选有两个以上重原子邻居的 sp3 碳（看上去更像候选），不够时再用甲基
+func MarkedAtoms(mol *Molecule, chiral []int, policy string, rng *rand.Rand) (map[int]bool, error) {
+	if err := CheckMarkerPolicy(policy); err != nil {
+		return nil, err
+	}
+	marked := make(map[int]bool)
+	switch policy {
+	case MarkerSP3:
+		for i := range mol.Atoms {
+			if mol.isSP3Carbon(i) {
+				marked[i+1] = true
+			}
+		}
+		// 手性中心不一定是 sp3 碳（例如带电荷的碳），仍然标出，避免反向泄露答案
+		for _, idx := range chiral {
+			marked[idx] = true
+		}
+	case MarkerDecoy, MarkerAnswers:
+		for _, idx := range chiral {
+			marked[idx] = true
+		}
+		if policy == MarkerAnswers {
+			break
+		}
+		var inner, terminal []int
+		for i := range mol.Atoms {
+			if marked[i+1] || !mol.isSP3Carbon(i) {
+				continue
+			}
+			if mol.heavyDegree(i) >= 2 {
+				inner = append(inner, i+1)
+			} else {
+				terminal = append(terminal, i+1)
+			}
+		}
+		rng.Shuffle(len(inner), func(a, b int) { inner[a], inner[b] = inner[b], inner[a] })
+		rng.Shuffle(len(terminal), func(a, b int) { terminal[a], terminal[b] = terminal[b], terminal[a] })
+		for _, idx := range append(inner, terminal...)[:min(len(chiral), len(inner)+len(terminal))] {
+			marked[idx] = true
+		}
+	}
+	return marked, nil
+}
@@ -0,0 +1,99 @@
+// File: molecule.go
+package main
+
+import "fmt"
+
+// Molecule 编辑 API。原子下标与 Bond.From/To 一致，均为 0-based；
+// 每次修改后都会丢弃 atomBondMap/chainTTL 缓存，下次 buildCaches 时重建。
+
+// AddAtom appends a copy of a and returns its 0-based index.
+func (m *Molecule) AddAtom(a Atom) int {
+	m.Atoms = append(m.Atoms, a)
+	m.invalidateCaches()
+	return len(m.Atoms) - 1
+}
+
+// AddBond connects atoms from and to (0-based) and returns the 0-based bond index.
+// Self bonds and duplicate bonds between the same pair of atoms are rejected.
+func (m *Molecule) AddBond(from, to, order int) (int, error) {
+	if from < 0 || from >= len(m.Atoms) || to < 0 || to >= len(m.Atoms) {
+		return -1, fmt.Errorf("AddBond: atom index out of range (%d, %d)", from, to)
+	}
+	if from == to {
+		return -1, fmt.Errorf("AddBond: self bond on atom %d", from)
+	}
+	if m.FindBond(from, to) >= 0 {
+		return -1, fmt.Errorf("AddBond: atoms %d and %d are already bonded", from, to)
+	}
+	m.Bonds = append(m.Bonds, Bond{From: from, To: to, Order: order})
+	m.invalidateCaches()
+	return len(m.Bonds) - 1, nil
+}
+
+// FindBond returns the 0-based index of the bond between atoms a and b, or -1.
+func (m *Molecule) FindBond(a, b int) int {
+	for i, bd := range m.Bonds {
+		if (bd.From == a && bd.To == b) || (bd.From == b && bd.To == a) {
+			return i
+		}
+	}
+	return -1
+}
+
+// SetOrder changes the order of the bond at 0-based index bond.
+func (m *Molecule) SetOrder(bond, order int) error {
+	if bond < 0 || bond >= len(m.Bonds) {
+		return fmt.Errorf("SetOrder: bond index %d out of range", bond)
+	}
+	m.Bonds[bond].Order = order
+	m.invalidateCaches()
+	return nil
+}
+
+// RemoveBond deletes the bond at 0-based index bond.
+func (m *Molecule) RemoveBond(bond int) error {
+	if bond < 0 || bond >= len(m.Bonds) {
+		return fmt.Errorf("RemoveBond: bond index %d out of range", bond)
+	}
+	m.Bonds = append(m.Bonds[:bond], m.Bonds[bond+1:]...)
+	m.invalidateCaches()
+	return nil
+}
+
+// RemoveAtom deletes the atom at 0-based index idx together with all of its bonds.
+// Atoms after idx shift down by one and the remaining bonds are renumbered.
+func (m *Molecule) RemoveAtom(idx int) error {
+	if idx < 0 || idx >= len(m.Atoms) {
+		return fmt.Errorf("RemoveAtom: atom index %d out of range", idx)
+	}
+	m.Atoms = append(m.Atoms[:idx], m.Atoms[idx+1:]...)
+
+	bonds := m.Bonds[:0]
+	for _, b := range m.Bonds {
+		if b.From == idx || b.To == idx {
+			continue
+		}
+		if b.From > idx {
+			b.From--
+		}
+		if b.To > idx {
+			b.To--
+		}
+		bonds = append(bonds, b)
+	}
+	m.Bonds = bonds
+	m.invalidateCaches()
+	return nil
+}
+
+// Copy returns a deep copy of m without caches, safe to edit independently.
+func (m *Molecule) Copy() *Molecule {
+	c := &Molecule{
+		Atoms:          make([]Atom, len(m.Atoms)),
+		Bonds:          make([]Bond, len(m.Bonds)),
+		IgnoreIsotopes: m.IgnoreIsotopes,
+	}
+	copy(c.Atoms, m.Atoms)
+	copy(c.Bonds, m.Bonds)
+	return c
+}
@@ -0,0 +1,147 @@
+// File: molecule_test.go
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// chain 建一条 n 个碳的直链：0-1-2-…
+func chain(t *testing.T, n int) *Molecule {
+	t.Helper()
+	m := &Molecule{}
+	for i := 0; i < n; i++ {
+		m.AddAtom(Atom{Element: "C", X: float64(i)})
+		if i > 0 {
+			if _, err := m.AddBond(i-1, i, 1); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return m
+}
+
+func TestMoleculeAddBondRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to int
+	}{
+		{"self bond", 1, 1},
+		{"duplicate", 0, 1},
+		{"duplicate reversed", 1, 0},
+		{"out of range", 0, 9},
+		{"negative", -1, 2},
+	}
+	for _, tt := range tests {
+		m := chain(t, 3)
+		if idx, err := m.AddBond(tt.from, tt.to, 1); err == nil {
+			t.Errorf("%s: AddBond(%d, %d) = %d, want error", tt.name, tt.from, tt.to, idx)
+		}
+		if len(m.Bonds) != 2 {
+			t.Errorf("%s: %d bonds after rejected AddBond, want 2", tt.name, len(m.Bonds))
+		}
+	}
+}
+
+func TestMoleculeRemoveAtom(t *testing.T) {
+	tests := []struct {
+		name   string
+		remove int
+		bonds  []Bond // 删除后剩下的键，已重新编号
+	}{
+		{"first", 0, []Bond{{From: 0, To: 1, Order: 1}, {From: 1, To: 2, Order: 1}}},
+		{"middle", 1, []Bond{{From: 1, To: 2, Order: 1}}},
+		{"last", 3, []Bond{{From: 0, To: 1, Order: 1}, {From: 1, To: 2, Order: 1}}},
+	}
+	for _, tt := range tests {
+		m := chain(t, 4)
+		m.buildCaches()
+		if err := m.RemoveAtom(tt.remove); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if len(m.Atoms) != 3 {
+			t.Errorf("%s: %d atoms, want 3", tt.name, len(m.Atoms))
+		}
+		if !reflect.DeepEqual(m.Bonds, tt.bonds) {
+			t.Errorf("%s: bonds = %v, want %v", tt.name, m.Bonds, tt.bonds)
+		}
+		if m.atomBondMap != nil {
+			t.Errorf("%s: caches not invalidated", tt.name)
+		}
+		// 重建的缓存与新的键一致，且没有越界
+		m.buildCaches()
+		for atom, ids := range m.atomBondMap {
+			for _, id := range ids {
+				if b := m.Bonds[id-1]; b.From != atom && b.To != atom {
+					t.Errorf("%s: atomBondMap[%d] lists bond %v", tt.name, atom, b)
+				}
+			}
+		}
+	}
+	if err := chain(t, 2).RemoveAtom(2); err == nil {
+		t.Error("RemoveAtom out of range succeeded")
+	}
+}
+
+func TestMoleculeFindBondAfterEdits(t *testing.T) {
+	m := chain(t, 4) // 0-1-2-3
+	steps := []struct {
+		name string
+		edit func() error
+		a, b int
+		want int
+	}{
+		{"initial", func() error { return nil }, 2, 3, 2},
+		{"after RemoveBond", func() error { return m.RemoveBond(0) }, 2, 3, 1},
+		{"removed bond gone", func() error { return nil }, 0, 1, -1},
+		{"after AddBond", func() error { _, err := m.AddBond(3, 0, 2); return err }, 0, 3, 2},
+		{"after RemoveAtom", func() error { return m.RemoveAtom(1) }, 1, 2, 0}, // 原 2-3 变为 1-2
+		{"ring closure kept", func() error { return nil }, 0, 2, 1},
+	}
+	for _, s := range steps {
+		if err := s.edit(); err != nil {
+			t.Fatalf("%s: %v", s.name, err)
+		}
+		if got := m.FindBond(s.a, s.b); got != s.want {
+			t.Errorf("%s: FindBond(%d, %d) = %d, want %d", s.name, s.a, s.b, got, s.want)
+		}
+	}
+}
+
+func TestMoleculeSetOrder(t *testing.T) {
+	m := chain(t, 3)
+	m.buildCaches()
+	if err := m.SetOrder(1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if m.Bonds[1].Order != 2 || m.atomBondMap != nil {
+		t.Errorf("order = %d, caches invalidated = %v", m.Bonds[1].Order, m.atomBondMap == nil)
+	}
+	if err := m.SetOrder(5, 1); err == nil {
+		t.Error("SetOrder out of range succeeded")
+	}
+}
+
+func TestMoleculeCopyIsIndependent(t *testing.T) {
+	m := chain(t, 3)
+	m.IgnoreIsotopes = true
+	m.buildCaches()
+	c := m.Copy()
+	if !reflect.DeepEqual(c.Atoms, m.Atoms) || !reflect.DeepEqual(c.Bonds, m.Bonds) || !c.IgnoreIsotopes {
+		t.Fatalf("copy differs from original")
+	}
+	if c.atomBondMap != nil {
+		t.Error("copy carries caches")
+	}
+
+	c.Atoms[0].Element = "N"
+	c.SetOrder(0, 2)
+	c.AddAtom(Atom{Element: "O"})
+	c.RemoveAtom(2)
+	if m.Atoms[0].Element != "C" || m.Bonds[0].Order != 1 || len(m.Atoms) != 3 || len(m.Bonds) != 2 {
+		t.Errorf("editing the copy changed the original: %+v", m)
+	}
+	if m.atomBondMap == nil {
+		t.Error("editing the copy invalidated the original's caches")
+	}
+}
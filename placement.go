@@ -0,0 +1,93 @@
+// File: placement.go
+package main
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+)
+
+// ErrNoClearPlacement 找不到让每个答案原子都清楚落在某个格子内的布局
+var ErrNoClearPlacement = errors.New("no unambiguous grid placement for answer atoms")
+
+// placementShiftSteps 每个方向尝试的平移档数，在半个格子宽/高内均分
+const placementShiftSteps = 6
+
+// AtomCell 返回原子（1-based）中心所在的格子列、行（0-based），以及它到最近格线的像素距离
+func AtomCell(mol *Molecule, cfg *MoleculeRenderConfig, idx int) (col, row int, edgeDist float64) {
+	p := AtomPixel(mol, cfg, idx)
+	px, py := p.X, p.Y
+	cellW := float64(cfg.Width) / float64(cfg.GridCountX)
+	cellH := float64(cfg.Height) / float64(cfg.GridCountY)
+
+	col = int(px / cellW)
+	row = int(py / cellH)
+	// 边界保护
+	if col < 0 {
+		col = 0
+	} else if col >= cfg.GridCountX {
+		col = cfg.GridCountX - 1
+	}
+	if row < 0 {
+		row = 0
+	} else if row >= cfg.GridCountY {
+		row = cfg.GridCountY - 1
+	}
+	fx := px - float64(col)*cellW
+	fy := py - float64(row)*cellH
+	edgeDist = math.Min(math.Min(fx, cellW-fx), math.Min(fy, cellH-fy))
+	return col, row, edgeDist
+}
+
+// placementMargin 答案原子离格线的最小距离：约一个手性星号/短标签的大小，但不超过格子的 1/4
+func placementMargin(cfg *MoleculeRenderConfig) float64 {
+	cellW := float64(cfg.Width) / float64(cfg.GridCountX)
+	cellH := float64(cfg.Height) / float64(cfg.GridCountY)
+	return math.Min(cfg.FontSize*0.6, math.Min(cellW, cellH)/4)
+}
+
+// answerCellsClear 每个答案原子都离格线至少 margin，且两两不在同一格
+func answerCellsClear(mol *Molecule, cfg *MoleculeRenderConfig, answers []int) bool {
+	margin := placementMargin(cfg)
+	used := make(map[[2]int]bool, len(answers))
+	for _, idx := range answers {
+		col, row, d := AtomCell(mol, cfg, idx)
+		if d < margin || used[[2]int{col, row}] {
+			return false
+		}
+		used[[2]int{col, row}] = true
+	}
+	return true
+}
+
+// PlaceAnswerGrid 按 sz 确定尺寸，按 spec 给出的候选网格（自动时从最紧凑的开始逐步加密），在半个格子内平移分子
+// （左侧 OffsetX 留白，顶部通过增高画布留白），直到所有答案原子都清楚地各占一格，并生成格子标签。
+// 实在找不到时返回 ErrNoClearPlacement，调用方应换一个分子
+func PlaceAnswerGrid(mol *Molecule, answers []int, sz RenderSizing, spec GridSpec, rng *rand.Rand) (*MoleculeRenderConfig, error) {
+	for _, g := range spec.candidates(len(answers)) {
+		if g[0]*g[1] < len(answers) {
+			continue
+		}
+		cfg, err := SizedRenderConfig(mol, sz, g[0], g[1])
+		if err != nil {
+			return nil, err
+		}
+		baseW, baseH := cfg.Width, cfg.Height
+		stepX := float64(baseW) / float64(g[0]) / 2 / placementShiftSteps
+		stepY := float64(baseH) / float64(g[1]) / 2 / placementShiftSteps
+		for sx := 0; sx < placementShiftSteps; sx++ {
+			for sy := 0; sy < placementShiftSteps; sy++ {
+				cfg.OffsetX = float64(int(float64(sx) * stepX))
+				cfg.Width = baseW + int(cfg.OffsetX)
+				cfg.Height = baseH + int(float64(sy)*stepY)
+				if answerCellsClear(mol, cfg, answers) {
+					if cfg.CellLabels, err = GridCellLabels(g[0], g[1], spec.Labels, rng); err != nil {
+						return nil, err
+					}
+					return cfg, nil
+				}
+			}
+		}
+	}
+	return nil, ErrNoClearPlacement
+}
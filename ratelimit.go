@@ -0,0 +1,268 @@
+// File: ratelimit.go
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 限流设置，main 中可由环境变量 CHIRAL_RATE_LIMIT、CHIRAL_START_RATE、CHIRAL_VERIFY_RATE、
+// CHIRAL_IMAGE_RATE、CHIRAL_TILE_RATE、CHIRAL_ADMIN_RATE、
+// CHIRAL_LOCKOUT_FAILURES、CHIRAL_LOCKOUT_DURATION、CHIRAL_TRUSTED_PROXIES 覆盖
+var (
+	EnableRateLimit = true
+	StartRate       = Rate{PerSecond: 30.0 / 60, Burst: 30}   // 每分钟 30 题
+	VerifyRate      = Rate{PerSecond: 60.0 / 60, Burst: 60}   // 每分钟 60 次验证
+	ImageRate       = Rate{PerSecond: 60.0 / 60, Burst: 60}   // 每分钟 60 张按倍率重绘的图片
+	TileRate        = Rate{PerSecond: 600.0 / 60, Burst: 600} // 每分钟 600 张切片（每题一般 9 张以上）
+	AdminRate       = Rate{PerSecond: 60.0 / 60, Burst: 60}   // 每分钟 60 次管理接口重绘
+
+	// 每道题的答错次数由 MaxAttempts 限制；按 IP 的锁定是第二道防线，阈值要高得多：
+	// NAT 或共用代理后面的所有用户共用一个 IP，锁定时他们都无法出题和验证
+	LockoutFailures = 20               // 窗口内累计答错几次后锁定，0 表示不锁定
+	LockoutDuration = 15 * time.Minute // 锁定时长，同时也是答错次数的统计窗口
+
+	// TrustedProxies 可信反向代理的地址段；只有直接连入的地址属于其中时才解析 X-Forwarded-For
+	TrustedProxies []*net.IPNet
+
+	startLimiter  = NewRateLimiter(StartRate)
+	verifyLimiter = NewRateLimiter(VerifyRate)
+	imageLimiter  = NewRateLimiter(ImageRate)
+	tileLimiter   = NewRateLimiter(TileRate)
+	adminLimiter  = NewRateLimiter(AdminRate)
+	lockout       = NewLockout(LockoutFailures, LockoutDuration)
+)
+
+// Rate 令牌桶参数：每秒补充 PerSecond 个令牌，桶容量 Burst
+type Rate struct {
+	PerSecond float64
+	Burst     float64
+}
+
+// ParseRate 解析 "30/m" 形式的限额（单位 s、m、h），桶容量等于该数量
+func ParseRate(s string) (Rate, error) {
+	n, unit, ok := strings.Cut(strings.TrimSpace(s), "/")
+	count, err := strconv.Atoi(n)
+	if !ok || err != nil || count <= 0 {
+		return Rate{}, fmt.Errorf("invalid rate %q (want e.g. 30/m)", s)
+	}
+	per := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}[unit]
+	if per == 0 {
+		return Rate{}, fmt.Errorf("invalid rate unit in %q (want s, m or h)", s)
+	}
+	return Rate{PerSecond: float64(count) / per.Seconds(), Burst: float64(count)}, nil
+}
+
+// RateLimiter 按客户端（IP）分别计数的令牌桶
+type RateLimiter struct {
+	rate    Rate
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func NewRateLimiter(rate Rate) *RateLimiter {
+	return &RateLimiter{rate: rate, buckets: make(map[string]*tokenBucket)}
+}
+
+// Allow 取一个令牌；桶空时返回 false 及需要等待的时间
+func (l *RateLimiter) Allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.rate.Burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.rate.Burst, b.tokens+now.Sub(b.last).Seconds()*l.rate.PerSecond)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate.PerSecond * float64(time.Second))
+	return false, wait
+}
+
+// Sweep 删除已经补满的桶，它们与新建的桶没有区别
+func (l *RateLimiter) Sweep(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for k, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate.PerSecond >= l.rate.Burst {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+// Lockout 按客户端统计答错次数：窗口内达到上限后锁定一段时间，期间开始和验证都返回 429
+type Lockout struct {
+	max      int
+	duration time.Duration
+	mu       sync.Mutex
+	clients  map[string]*failureCount
+}
+
+type failureCount struct {
+	count int
+	first time.Time // 本窗口第一次答错的时间
+	until time.Time // 锁定到期时间，零值表示未锁定
+}
+
+func NewLockout(max int, duration time.Duration) *Lockout {
+	return &Lockout{max: max, duration: duration, clients: make(map[string]*failureCount)}
+}
+
+// Locked 返回剩余锁定时间，未锁定时为 0
+func (l *Lockout) Locked(key string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if f, ok := l.clients[key]; ok && now.Before(f.until) {
+		return f.until.Sub(now)
+	}
+	return 0
+}
+
+// Fail 记一次答错，达到上限时开始锁定并返回 true
+func (l *Lockout) Fail(key string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, ok := l.clients[key]
+	if !ok || now.Sub(f.first) > l.duration {
+		f = &failureCount{first: now}
+		l.clients[key] = f
+	}
+	f.count++
+	if l.max > 0 && f.count >= l.max {
+		f.until = now.Add(l.duration)
+		f.count, f.first = 0, f.until
+		return true
+	}
+	return false
+}
+
+// Reset 答对后清零
+func (l *Lockout) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.clients, key)
+}
+
+// Sweep 删除窗口和锁定都已过期的记录
+func (l *Lockout) Sweep(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for k, f := range l.clients {
+		if now.After(f.until) && now.Sub(f.first) > l.duration {
+			delete(l.clients, k)
+		}
+	}
+}
+
+// RunClientSweeper 每隔 interval 清理限流与锁定记录，不返回；在 main 中用 go 启动
+func RunClientSweeper(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for now := range t.C {
+		for _, l := range []*RateLimiter{startLimiter, verifyLimiter, imageLimiter, tileLimiter, adminLimiter} {
+			l.Sweep(now)
+		}
+		lockout.Sweep(now)
+	}
+}
+
+// ParseTrustedProxies 解析逗号分隔的 CIDR 或单个 IP
+func ParseTrustedProxies(s string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if !strings.Contains(part, "/") {
+			ip := net.ParseIP(part)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", part)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", part)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func trustedProxy(ip net.IP) bool {
+	for _, n := range TrustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP 客户端地址：直接连入的地址不是可信代理时就用它（忽略 X-Forwarded-For，防止伪造）；
+// 否则从 X-Forwarded-For 最右端往左跳过可信代理，第一个不可信的地址即客户端
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !trustedProxy(ip) {
+		return host
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !trustedProxy(hop) {
+			break
+		}
+	}
+	return ip.String()
+}
+
+// tooManyRequests 写出 429 及 Retry-After（秒，向上取整）
+func tooManyRequests(w http.ResponseWriter, wait time.Duration, msg string) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	http.Error(w, msg, http.StatusTooManyRequests)
+}
+
+// limitClient 检查锁定与令牌桶，超限时写出 429 并返回 false
+func limitClient(w http.ResponseWriter, ip string, l *RateLimiter) bool {
+	if !EnableRateLimit {
+		return true
+	}
+	now := time.Now()
+	if wait := lockout.Locked(ip, now); wait > 0 {
+		tooManyRequests(w, wait, "too many failed attempts, try again later")
+		return false
+	}
+	if ok, wait := l.Allow(ip, now); !ok {
+		tooManyRequests(w, wait, "rate limit exceeded, try again later")
+		return false
+	}
+	return true
+}
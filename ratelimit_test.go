@@ -0,0 +1,141 @@
+// File: ratelimit_test.go
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8, 127.0.0.1, ::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := TrustedProxies
+	TrustedProxies = proxies
+	t.Cleanup(func() { TrustedProxies = saved })
+
+	tests := []struct {
+		name   string
+		remote string
+		xff    []string
+		want   string
+	}{
+		{"direct client", "203.0.113.7:5000", nil, "203.0.113.7"},
+		{"untrusted peer with spoofed xff", "203.0.113.7:5000", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"trusted proxy, empty xff", "10.1.2.3:5000", nil, "10.1.2.3"},
+		{"trusted proxy", "127.0.0.1:5000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"chained trusted proxies", "10.1.2.3:5000", []string{"198.51.100.1, 10.9.9.9", "10.8.8.8"}, "198.51.100.1"},
+		{"client spoofs left of real hop", "10.1.2.3:5000", []string{"1.1.1.1, 198.51.100.1"}, "198.51.100.1"},
+		{"all hops trusted", "10.1.2.3:5000", []string{"10.4.4.4"}, "10.4.4.4"},
+		{"malformed hop", "10.1.2.3:5000", []string{"garbage"}, "10.1.2.3"},
+		{"ipv6 trusted proxy", "[::1]:5000", []string{"2001:db8::5"}, "2001:db8::5"},
+		{"no port", "203.0.113.7", nil, "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remote
+		for _, v := range tt.xff {
+			r.Header.Add("X-Forwarded-For", v)
+		}
+		if got := ClientIP(r); got != tt.want {
+			t.Errorf("%s: ClientIP = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		in        string
+		perSecond float64
+		burst     float64
+		ok        bool
+	}{
+		{"30/m", 0.5, 30, true},
+		{"2/s", 2, 2, true},
+		{" 3600/h ", 1, 3600, true},
+		{"30", 0, 0, false},
+		{"30/d", 0, 0, false},
+		{"0/m", 0, 0, false},
+		{"-1/m", 0, 0, false},
+		{"x/m", 0, 0, false},
+		{"", 0, 0, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseRate(tt.in)
+		if (err == nil) != tt.ok {
+			t.Errorf("ParseRate(%q) err = %v, want ok = %v", tt.in, err, tt.ok)
+			continue
+		}
+		if tt.ok && (got.PerSecond != tt.perSecond || got.Burst != tt.burst) {
+			t.Errorf("ParseRate(%q) = %+v, want %v/s burst %v", tt.in, got, tt.perSecond, tt.burst)
+		}
+	}
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	l := NewRateLimiter(Rate{PerSecond: 1, Burst: 2})
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.Allow("a", now); !ok {
+			t.Fatalf("request %d within burst refused", i+1)
+		}
+	}
+	ok, wait := l.Allow("a", now)
+	if ok || wait <= 0 || wait > time.Second {
+		t.Errorf("over burst: ok = %v, wait = %v", ok, wait)
+	}
+	if ok, _ := l.Allow("b", now); !ok {
+		t.Error("other client limited")
+	}
+	if ok, _ := l.Allow("a", now.Add(time.Second)); !ok {
+		t.Error("token not refilled after 1s")
+	}
+}
+
+func TestLockoutFail(t *testing.T) {
+	start := time.Now()
+	tests := []struct {
+		name     string
+		max      int
+		fails    []time.Duration // 每次答错距 start 的时间
+		starts   bool            // 最后一次答错是否开始锁定
+		lockedAt time.Duration   // 检查 Locked 的时间
+		locked   bool
+	}{
+		{"below threshold", 3, []time.Duration{0, time.Second}, false, 2 * time.Second, false},
+		{"reaches threshold", 3, []time.Duration{0, time.Second, 2 * time.Second}, true, 3 * time.Second, true},
+		{"lock expires", 3, []time.Duration{0, time.Second, 2 * time.Second}, true, 2*time.Second + time.Minute + time.Millisecond, false},
+		{"window restarts", 3, []time.Duration{0, time.Second, 2 * time.Minute}, false, 2*time.Minute + time.Second, false},
+		{"disabled", 0, []time.Duration{0, 0, 0, 0}, false, time.Second, false},
+	}
+	for _, tt := range tests {
+		l := NewLockout(tt.max, time.Minute)
+		started := false
+		for i, d := range tt.fails {
+			if l.Fail("ip", start.Add(d)) {
+				if i != len(tt.fails)-1 || !tt.starts {
+					t.Errorf("%s: lockout started at failure %d", tt.name, i+1)
+				}
+				started = true
+			}
+		}
+		if started != tt.starts {
+			t.Errorf("%s: Fail reported lockout = %v, want %v", tt.name, started, tt.starts)
+		}
+		if got := l.Locked("ip", start.Add(tt.lockedAt)) > 0; got != tt.locked {
+			t.Errorf("%s: Locked = %v, want %v", tt.name, got, tt.locked)
+		}
+		if l.Locked("other", start.Add(tt.lockedAt)) > 0 {
+			t.Errorf("%s: other client locked", tt.name)
+		}
+	}
+
+	l := NewLockout(2, time.Minute)
+	l.Fail("ip", start)
+	l.Reset("ip")
+	if l.Fail("ip", start.Add(time.Second)) {
+		t.Error("Reset did not clear the failure count")
+	}
+}
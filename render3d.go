@@ -0,0 +1,329 @@
+// File: render3d.go
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/color"
+	"image/png"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+
+	"github.com/fogleman/gg"
+)
+
+// ErrNo3DCoordinates 分子没有 3D 构象坐标（Z 全为 0），无法画球棍模型
+var ErrNo3DCoordinates = errors.New("molecule has no 3D coordinates")
+
+// BallStickConfig 球棍模型渲染配置。坐标、半径都按 1x 像素计算，Scale 只影响输出像素
+type BallStickConfig struct {
+	Width, Height int     // 画布尺寸（1x）
+	Scale         int     // 像素倍率，0 按 1 处理
+	Eye           Vec3    // 观察方向（从分子指向观察者）
+	Spin          float64 // 绕视线的旋转角（弧度）
+	Distance      float64 // 相机到分子中心的距离，以外接球半径为单位；越小透视越强
+	Theme         *Theme  // 只用其底色，原子一律按 CPK 着色
+}
+
+// 球棍模型默认尺寸
+const (
+	ballStickSize     = 400  // 画布边长（1x 像素）
+	ballStickMargin   = 12   // 四周留白
+	ballStickDistance = 4.0  // 默认相机距离
+	ballRadiusRatio   = 0.25 // 球半径 = 范德华半径 × 该比例（Å）
+	stickRadius       = 0.1  // 键半径（Å）
+	ballFog           = 0.35 // 最远处向底色混合的比例，提供深度感
+)
+
+// vdwRadius 范德华半径（Å），未列出的元素按 1.8
+var vdwRadius = map[string]float64{
+	"H": 1.2, "C": 1.7, "N": 1.55, "O": 1.52, "F": 1.47, "P": 1.8, "S": 1.8,
+	"Cl": 1.75, "Br": 1.85, "I": 1.98, "B": 1.92, "Si": 2.1,
+}
+
+// ballColors Jmol 风格的 CPK 配色，未列出的元素用粉色
+var ballColors = map[string]string{
+	"H": "#FFFFFF", "C": "#909090", "N": "#3050F8", "O": "#FF0D0D", "F": "#90E050",
+	"P": "#FF8000", "S": "#FFFF30", "Cl": "#1FF01F", "Br": "#A62929", "I": "#940094",
+	"B": "#FFB5B5", "Si": "#F0C8A0",
+}
+
+// RandomBallStickConfig 随机观察方向（球面均匀分布）和旋转角
+func RandomBallStickConfig(rng *rand.Rand) *BallStickConfig {
+	z := 2*rng.Float64() - 1
+	phi := 2 * math.Pi * rng.Float64()
+	s := math.Sqrt(1 - z*z)
+	return &BallStickConfig{
+		Width:    ballStickSize,
+		Height:   ballStickSize,
+		Eye:      Vec3{s * math.Cos(phi), s * math.Sin(phi), z},
+		Spin:     2 * math.Pi * rng.Float64(),
+		Distance: ballStickDistance,
+	}
+}
+
+// BallStickView 一次投影的结果（1x 像素）：原子中心、球半径与深度（越大越靠近观察者）
+type BallStickView struct {
+	Points []Point
+	Radii  []float64
+	Depth  []float64
+	Bond   float64 // 平均键长换算成的像素，用于点击容差
+
+	pxPerAngstrom float64
+}
+
+// ProjectBallStick 把 3D 坐标透视投影到画布上，并整体缩放居中
+func ProjectBallStick(mol *Molecule, cfg *BallStickConfig) (*BallStickView, error) {
+	if !mol.Is3D() {
+		return nil, ErrNo3DCoordinates
+	}
+	n := len(mol.Atoms)
+	var c Vec3
+	for _, a := range mol.Atoms {
+		c = Vec3{c.X + a.X, c.Y + a.Y, c.Z + a.Z}
+	}
+	c = Vec3{c.X / float64(n), c.Y / float64(n), c.Z / float64(n)}
+	radius := 1.0
+	for _, a := range mol.Atoms {
+		radius = math.Max(radius, a.Pos().Sub(c).Norm())
+	}
+
+	// 屏幕坐标系：u 右、v 上、w 朝向观察者，u/v 再绕视线转 Spin
+	u, v, w := ViewBasis(cfg.Eye)
+	cs, sn := math.Cos(cfg.Spin), math.Sin(cfg.Spin)
+	u, v = Vec3{u.X*cs + v.X*sn, u.Y*cs + v.Y*sn, u.Z*cs + v.Z*sn}, Vec3{v.X*cs - u.X*sn, v.Y*cs - u.Y*sn, v.Z*cs - u.Z*sn}
+	dist := cfg.Distance
+	if dist <= 1 {
+		dist = ballStickDistance
+	}
+	dist *= radius
+
+	view := &BallStickView{Points: make([]Point, n), Radii: make([]float64, n), Depth: make([]float64, n)}
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for i, a := range mol.Atoms {
+		q := a.Pos().Sub(c)
+		z := q.Dot(w)
+		f := dist / (dist - z)
+		r := ballRadius(a.Element) * f
+		p := Point{X: q.Dot(u) * f, Y: -q.Dot(v) * f}
+		view.Points[i], view.Radii[i], view.Depth[i] = p, r, z
+		minX, maxX = math.Min(minX, p.X-r), math.Max(maxX, p.X+r)
+		minY, maxY = math.Min(minY, p.Y-r), math.Max(maxY, p.Y+r)
+	}
+
+	// 缩放到画布（Å → 像素）并居中
+	k := math.Min(float64(cfg.Width-2*ballStickMargin)/(maxX-minX), float64(cfg.Height-2*ballStickMargin)/(maxY-minY))
+	ox := (float64(cfg.Width) - k*(maxX-minX)) / 2
+	oy := (float64(cfg.Height) - k*(maxY-minY)) / 2
+	for i := range view.Points {
+		view.Points[i].X = ox + k*(view.Points[i].X-minX)
+		view.Points[i].Y = oy + k*(view.Points[i].Y-minY)
+		view.Radii[i] *= k
+	}
+	view.pxPerAngstrom = k
+	view.Bond = k * mol.AverageBondLength3D()
+	return view, nil
+}
+
+// ballRadius 原子球半径（Å）
+func ballRadius(e string) float64 {
+	r, ok := vdwRadius[e]
+	if !ok {
+		r = 1.8
+	}
+	return r * ballRadiusRatio
+}
+
+// AverageBondLength3D 按 3D 坐标计算的平均键长
+func (m *Molecule) AverageBondLength3D() float64 {
+	if len(m.Bonds) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, b := range m.Bonds {
+		sum += m.Atoms[b.From].Pos().Sub(m.Atoms[b.To].Pos()).Norm()
+	}
+	return sum / float64(len(m.Bonds))
+}
+
+// Occluded reports whether the centre of atom i is hidden behind a nearer ball.
+func (v *BallStickView) Occluded(i int) bool {
+	for j := range v.Points {
+		if j == i || v.Depth[j] <= v.Depth[i] {
+			continue
+		}
+		if math.Hypot(v.Points[j].X-v.Points[i].X, v.Points[j].Y-v.Points[i].Y) < v.Radii[j] {
+			return true
+		}
+	}
+	return false
+}
+
+// ClickRadius 球棍模型上的点击容差半径（像素），与 2D 点击模式同比例
+func (v *BallStickView) ClickRadius() float64 {
+	return math.Max(clickRadiusRatio*v.Bond, 4)
+}
+
+// ballPrim 一个待绘制的图元：球，或从 (x,y) 到 (x2,y2) 的半根键
+type ballPrim struct {
+	depth      float64
+	stick      bool
+	x, y, r    float64
+	x2, y2     float64
+	col        color.RGBA
+	depthRatio float64 // 0 最近，1 最远
+}
+
+// RenderBallStick 按画家算法（由远及近）绘制球棍模型，返回 PNG 与投影结果。
+// 每根键从中点分成两半，各取所连原子的颜色
+func RenderBallStick(mol *Molecule, cfg *BallStickConfig) ([]byte, *BallStickView, error) {
+	view, err := ProjectBallStick(mol, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	theme := cfg.Theme
+	if theme == nil {
+		if theme, err = LookupTheme(""); err != nil {
+			return nil, nil, err
+		}
+	}
+	s := float64(max(cfg.Scale, 1))
+	bg, err := parseHexColor(theme.Background)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	minZ, maxZ := math.Inf(1), math.Inf(-1)
+	for _, z := range view.Depth {
+		minZ, maxZ = math.Min(minZ, z), math.Max(maxZ, z)
+	}
+	fog := func(z float64) float64 {
+		if maxZ-minZ < 1e-9 {
+			return 0
+		}
+		return (maxZ - z) / (maxZ - minZ)
+	}
+	colorOf := func(i int) (color.RGBA, error) {
+		hex, ok := ballColors[mol.Atoms[i].Element]
+		if !ok {
+			hex = "#FF1493"
+		}
+		return parseHexColor(hex)
+	}
+
+	var prims []ballPrim
+	for i, p := range view.Points {
+		col, err := colorOf(i)
+		if err != nil {
+			return nil, nil, err
+		}
+		prims = append(prims, ballPrim{depth: view.Depth[i], x: p.X * s, y: p.Y * s, r: view.Radii[i] * s, col: col, depthRatio: fog(view.Depth[i])})
+	}
+	stickPx := stickRadius * view.pxPerAngstrom * s
+	for _, b := range mol.Bonds {
+		pa, pb := view.Points[b.From], view.Points[b.To]
+		mx, my := (pa.X+pb.X)/2, (pa.Y+pb.Y)/2
+		for _, end := range []int{b.From, b.To} {
+			col, err := colorOf(end)
+			if err != nil {
+				return nil, nil, err
+			}
+			p := view.Points[end]
+			z := (view.Depth[b.From]+view.Depth[b.To])/4 + view.Depth[end]/2
+			prims = append(prims, ballPrim{depth: z, stick: true, x: p.X * s, y: p.Y * s, x2: mx * s, y2: my * s, r: stickPx, col: col, depthRatio: fog(z)})
+		}
+	}
+	sort.SliceStable(prims, func(i, j int) bool { return prims[i].depth < prims[j].depth })
+
+	dc := gg.NewContext(cfg.Width*int(s), cfg.Height*int(s))
+	dc.SetColor(bg)
+	dc.Clear()
+	for _, p := range prims {
+		base := mixColor(p.col, bg, ballFog*p.depthRatio)
+		if p.stick {
+			drawStick(dc, p, base)
+		} else {
+			drawBall(dc, p, base)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, dc.Image()); err != nil {
+		return nil, nil, err
+	}
+	return buf.Bytes(), view, nil
+}
+
+// drawBall 径向渐变的球：左上方高光，边缘压暗，再描一圈细边
+func drawBall(dc *gg.Context, p ballPrim, base color.RGBA) {
+	g := gg.NewRadialGradient(p.x-p.r/3, p.y-p.r/3, 0, p.x, p.y, p.r)
+	g.AddColorStop(0, mixColor(base, color.RGBA{255, 255, 255, 255}, 0.7))
+	g.AddColorStop(0.6, base)
+	g.AddColorStop(1, mixColor(base, color.RGBA{0, 0, 0, 255}, 0.45))
+	dc.DrawCircle(p.x, p.y, p.r)
+	dc.SetFillStyle(g)
+	dc.FillPreserve()
+	dc.SetColor(mixColor(base, color.RGBA{0, 0, 0, 255}, 0.6))
+	dc.SetLineWidth(math.Max(0.5, p.r/20))
+	dc.Stroke()
+}
+
+// drawStick 半根键画成矩形，沿法向做线性渐变模拟圆柱
+func drawStick(dc *gg.Context, p ballPrim, base color.RGBA) {
+	dx, dy := p.x2-p.x, p.y2-p.y
+	l := math.Hypot(dx, dy)
+	if l < 1e-9 {
+		return
+	}
+	nx, ny := -dy/l*p.r, dx/l*p.r
+	g := gg.NewLinearGradient(p.x+nx, p.y+ny, p.x-nx, p.y-ny)
+	g.AddColorStop(0, mixColor(base, color.RGBA{0, 0, 0, 255}, 0.45))
+	g.AddColorStop(0.35, mixColor(base, color.RGBA{255, 255, 255, 255}, 0.5))
+	g.AddColorStop(1, mixColor(base, color.RGBA{0, 0, 0, 255}, 0.45))
+	dc.NewSubPath()
+	dc.MoveTo(p.x+nx, p.y+ny)
+	dc.LineTo(p.x2+nx, p.y2+ny)
+	dc.LineTo(p.x2-nx, p.y2-ny)
+	dc.LineTo(p.x-nx, p.y-ny)
+	dc.ClosePath()
+	dc.SetFillStyle(g)
+	dc.Fill()
+}
+
+// mixColor 按比例 t 把 a 向 b 混合
+func mixColor(a, b color.RGBA, t float64) color.RGBA {
+	mix := func(x, y uint8) uint8 { return uint8(math.Round(float64(x) + (float64(y)-float64(x))*t)) }
+	return color.RGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), 255}
+}
+
+// parseHexColor 解析主题里的 #RRGGBB 颜色
+func parseHexColor(s string) (color.RGBA, error) {
+	if len(s) != 7 || s[0] != '#' {
+		return color.RGBA{}, fmt.Errorf("invalid colour %q", s)
+	}
+	v, err := strconv.ParseUint(s[1:], 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid colour %q", s)
+	}
+	return color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 255}, nil
+}
+
+// visibleCentres 在 cfg 的角度下投影分子，返回手性原子（1-based）的像素坐标与点击容差；
+// 有手性原子被挡住时返回错误，调用方应换一个角度
+func visibleCentres(mol *Molecule, cfg *BallStickConfig, chiral []int) ([]Point, float64, error) {
+	view, err := ProjectBallStick(mol, cfg)
+	if err != nil {
+		return nil, 0, err
+	}
+	points := make([]Point, len(chiral))
+	for i, idx := range chiral {
+		if view.Occluded(idx - 1) {
+			return nil, 0, fmt.Errorf("chiral atom %d is hidden in this view", idx)
+		}
+		points[i] = view.Points[idx-1]
+	}
+	return points, view.ClickRadius(), nil
+}
@@ -5,48 +5,62 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
-	"image/png"
 	"math"
 	"math/rand"
 	"os"
-
-	"github.com/fogleman/gg"
 )
 
+// DefaultAromaticCircles 站点默认是否给芳香环画内圆，main 中可用 CHIRAL_AROMATIC=circle 打开，
+// 请求可用 ?aromatic=circle|kekule 覆盖
+var DefaultAromaticCircles = false
+
+// ParseAromaticStyle 解析芳香环画法：circle 画内圆，kekule 画单双键，空字符串取站点默认
+func ParseAromaticStyle(s string) (bool, error) {
+	switch s {
+	case "":
+		return DefaultAromaticCircles, nil
+	case "circle":
+		return true, nil
+	case "kekule":
+		return false, nil
+	}
+	return false, fmt.Errorf("unsupported aromatic style: %s", s)
+}
+
 // MoleculeRenderConfig 与 Java 版 MoleculeRenderConfig 对应
 type MoleculeRenderConfig struct {
-	Width, Height          int     // 画布尺寸
-	FontSize               float64 // 字体大小
-	ScaleFactor            float64 // 缩放因子
-	GridCountX, GridCountY int     // 网格行列数
-	DrawGrid               bool    // 是否绘制背景网格
+	Width, Height          int      // 画布尺寸
+	FontSize               float64  // 字体大小
+	ScaleFactor            float64  // 缩放因子
+	OffsetX                float64  // 分子整体右移的像素（PlaceAnswerGrid 用来避开格线）
+	GridCountX, GridCountY int      // 网格行列数
+	CellLabels             []string // 每格标签，列优先，nil 时为 A1、B2…（见 grid.go）
+	DrawGrid               bool     // 是否绘制背景网格
+	Format                 string   // 输出格式：FormatPNG（默认）或 FormatSVG
+	AromaticCircles        bool     // 芳香环画内圆（Kekulé 苯环的双键改画单键）；关闭时芳香键（order 4）按 Kekulé 式画单双键
+	Theme                  *Theme   // 配色，nil 时用 DefaultThemeName
+	FontFamily             string   // 字体族（见 fonts.go），空字符串用 DefaultFontFamily
+	LineWidthScale         float64  // 线宽倍数，0 按 1 处理
+	NoiseDensity           float64  // 背景噪点密度，见 drawNoise
 
 	// 每个原子文字或符号的边界
 	LabelLeft, LabelRight, LabelTop, LabelBottom []float64
 
 	// 需标记的手性碳（1-based 索引）
 	ShownChiral map[int]bool
+
+	// 手性中心编号（1-based 索引 → "1"、"2"…），R/S 题在碳原子右上角写编号代替★
+	CentreLabels map[int]string
+
+	// 调试叠加层（见 debug.go），nil 时不画
+	Debug *DebugOverlay
 }
 
-// CalculateRenderConfig 根据 Java 版逻辑，计算 fontSize, scaleFactor 并确定画布大小
-// maxSize 对应 "最大边长"，gridX/gridY 对应网格行列数
-func CalculateRenderConfig(mol *Molecule, maxSize, gridX, gridY int) (*MoleculeRenderConfig, error) {
-	rx := mol.RangeX()
-	ry := mol.RangeY()
-	if rx == 0 || ry == 0 {
-		return nil, fmt.Errorf("molecule has no range")
-	}
-	// Java: scaleFactor = min(maxSize/rx, maxSize/ry)
-	scale := math.Min(float64(maxSize)/rx, float64(maxSize)/ry)
-	// Java: fontSize = avgBondLength/1.8*scale, 并 cap 到 maxSize/16
-	avgBond := mol.AverageBondLength()
-	fontSize := avgBond / 1.8 * scale
-	if fontSize > float64(maxSize)/16.0 {
-		fontSize = float64(maxSize) / 16.0
-	}
+// newRenderConfig 按给定缩放与字号生成配置：画布为分子范围加上四周各一个字号的留白
+func newRenderConfig(mol *Molecule, scale, fontSize float64, gridX, gridY int) *MoleculeRenderConfig {
 	// Java: width = rx*scale, height = ry*scale
-	w := int(rx * scale)
-	h := int(ry * scale)
+	w := int(mol.RangeX() * scale)
+	h := int(mol.RangeY() * scale)
 
 	cfg := &MoleculeRenderConfig{
 		Width:       w + 2*int(fontSize),
@@ -64,46 +78,61 @@ func CalculateRenderConfig(mol *Molecule, maxSize, gridX, gridY int) (*MoleculeR
 	cfg.LabelRight = make([]float64, n)
 	cfg.LabelTop = make([]float64, n)
 	cfg.LabelBottom = make([]float64, n)
-	return cfg, nil
+	return cfg
 }
 
-// RenderMoleculeImage 按 Java renderMoleculeAsImage 逻辑绘制并返回 PNG 字节 + 区域标签列表
+// RenderMoleculeImage 按 Java renderMoleculeAsImage 逻辑绘制并返回图片字节（PNG 或 SVG，见 cfg.Format）+ 区域标签列表
 func RenderMoleculeImage(mol *Molecule, cfg *MoleculeRenderConfig) ([]byte, []string, error) {
-	dc := gg.NewContext(cfg.Width, cfg.Height)
-	// 白底
-	dc.SetRGB(1, 1, 1)
+	if err := CheckFontFamily(cfg.FontFamily); err != nil {
+		return nil, nil, err
+	}
+	dc, err := newRenderer(cfg.Format, cfg.Width, cfg.Height)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cfg.Theme == nil {
+		if cfg.Theme, err = LookupTheme(""); err != nil {
+			return nil, nil, err
+		}
+	}
+	// 底色
+	dc.SetHexColor(cfg.Theme.Background)
 	dc.Clear()
 	if cfg.DrawGrid {
 		drawGridBackground(dc, cfg)
 	}
+	drawNoise(dc, cfg)
 	doDrawMolecule(dc, mol, cfg)
+	if cfg.Debug != nil {
+		drawDebugOverlay(dc, mol, cfg)
+	}
 
-	// 输出 PNG
+	// 输出 PNG / SVG
 	var buf bytes.Buffer
-	if err := png.Encode(&buf, dc.Image()); err != nil {
+	if err := dc.Encode(&buf); err != nil {
 		return nil, nil, err
 	}
-	// 区域标签 A1, A2, ... B1...
+	// 区域标签 A1, A2, ... B1...（或 cfg.CellLabels 指定的方案）
 	regions := make([]string, 0, cfg.GridCountX*cfg.GridCountY)
 	for i := 0; i < cfg.GridCountX; i++ {
 		for j := 0; j < cfg.GridCountY; j++ {
-			regions = append(regions, fmt.Sprintf("%c%d", 'A'+i, j+1))
+			regions = append(regions, cfg.CellLabel(i, j))
 		}
 	}
 	return buf.Bytes(), regions, nil
 }
 
 // drawGridBackground 对应 doDrawGridTagForBackground
-func drawGridBackground(dc *gg.Context, cfg *MoleculeRenderConfig) {
+func drawGridBackground(dc Renderer, cfg *MoleculeRenderConfig) {
 	unitX := float64(cfg.Width) / float64(cfg.GridCountX)
 	unitY := float64(cfg.Height) / float64(cfg.GridCountY)
 	// 绘制双色棋盘格
 	for i := 0; i < cfg.GridCountX; i++ {
 		for j := 0; j < cfg.GridCountY; j++ {
 			if (i+j)%2 == 0 {
-				dc.SetHexColor("#FFFFFF")
+				dc.SetHexColor(cfg.Theme.GridEven)
 			} else {
-				dc.SetHexColor("#E0E0E0")
+				dc.SetHexColor(cfg.Theme.GridOdd)
 			}
 			dc.DrawRectangle(float64(i)*unitX, float64(j)*unitY, unitX, unitY)
 			dc.Fill()
@@ -111,11 +140,11 @@ func drawGridBackground(dc *gg.Context, cfg *MoleculeRenderConfig) {
 	}
 	// 标签文字
 	labelSize := math.Min(math.Min(unitX, unitY)/2.0, cfg.FontSize)
-	dc.SetRGB(0.627, 0.627, 0.627)
-	dc.LoadFontFace("Roboto-Regular.ttf", labelSize)
+	dc.SetHexColor(cfg.Theme.GridLabel)
+	dc.SetFont(cfg.FontFamily, labelSize)
 	for i := 0; i < cfg.GridCountX; i++ {
 		for j := 0; j < cfg.GridCountY; j++ {
-			tag := fmt.Sprintf("%c%d", 'A'+i, j+1)
+			tag := cfg.CellLabel(i, j)
 			x := float64(i)*unitX + labelSize*0.25
 			y := float64(j+1)*unitY - dc.FontHeight()/2
 			dc.DrawString(tag, x, y)
@@ -124,52 +153,90 @@ func drawGridBackground(dc *gg.Context, cfg *MoleculeRenderConfig) {
 }
 
 // doDrawMolecule 对应 Java doDrawMolecule（简化版）
-func doDrawMolecule(dc *gg.Context, mol *Molecule, cfg *MoleculeRenderConfig) {
-	dc.SetLineWidth(cfg.FontSize / 12)
-	dc.SetRGB(0, 0, 0)
-	dc.LoadFontFace("Roboto-Regular.ttf", cfg.FontSize)
+func doDrawMolecule(dc Renderer, mol *Molecule, cfg *MoleculeRenderConfig) {
+	lineScale := cfg.LineWidthScale
+	if lineScale <= 0 {
+		lineScale = 1
+	}
+	dc.SetLineWidth(cfg.FontSize / 12 * lineScale)
+	dc.SetHexColor(cfg.Theme.Bond)
+	dc.SetFont(cfg.FontFamily, cfg.FontSize)
 
 	// 1) 绘制原子标签 & 计算 padding
+	hidden := foldedHydrogens(mol)
 	for i, a := range mol.Atoms {
-		x := cfg.FontSize + cfg.ScaleFactor*(a.X-mol.MinX())
+		x := cfg.OffsetX + cfg.FontSize + cfg.ScaleFactor*(a.X-mol.MinX())
 		y := float64(cfg.Height) - cfg.FontSize - cfg.ScaleFactor*(a.Y-mol.MinY())
-		// 碳原子不画元素符号，只画手性★
-		if a.Element == "C" {
+		// 已并入杂原子标签的氢不单独绘制
+		if hidden[i] {
 			cfg.LabelLeft[i] = 0
 			cfg.LabelRight[i] = 0
 			cfg.LabelTop[i] = 0
 			cfg.LabelBottom[i] = 0
-			if cfg.ShownChiral[i+1] {
+			continue
+		}
+		// 普通碳原子不画元素符号，只画手性★；带同位素或电荷的碳按杂原子画标签
+		if a.Element == "C" && a.Isotope == 0 && a.Charge == 0 && a.Label == "" {
+			cfg.LabelLeft[i] = 0
+			cfg.LabelRight[i] = 0
+			cfg.LabelTop[i] = 0
+			cfg.LabelBottom[i] = 0
+			if s, ok := cfg.CentreLabels[i+1]; ok {
+				small := cfg.FontSize * labelScriptScale
+				dc.SetFont(cfg.FontFamily, small)
+				w, _ := dc.MeasureString(s)
+				r := w/2 + small/2
+				dc.SetHexColor(cfg.Theme.Marker)
+				dc.DrawStringAnchored(s, x+r, y-r, 0.5, 0.5)
+				dc.SetHexColor(cfg.Theme.Bond)
+				dc.SetFont(cfg.FontFamily, cfg.FontSize)
+			} else if cfg.ShownChiral[i+1] {
 				s := "*"
 				w, _ := dc.MeasureString(s)
 				r := w/4 + cfg.FontSize/4
+				dc.SetHexColor(cfg.Theme.Marker)
 				dc.DrawStringAnchored(s, x+r, y-r, 0.5, 0.5)
+				dc.SetHexColor(cfg.Theme.Bond)
 			}
 		} else {
-			// 非碳元素：先测文字宽度，设置 padding
-			w, _ := dc.MeasureString(a.Element)
-			cfg.LabelLeft[i] = w / 2
-			cfg.LabelRight[i] = w / 2
-			cfg.LabelTop[i] = cfg.FontSize / 2
-			cfg.LabelBottom[i] = cfg.FontSize / 2
-			// 元素文字居中绘制
-			dc.DrawStringAnchored(a.Element, x, y, 0.5, 0.5)
+			// 非碳元素：元素符号 + 氢 + 电荷 + 同位素，同时设置 padding；缩写基团画标签
+			dc.SetHexColor(cfg.Theme.AtomColor(a.Element))
+			if a.Label != "" {
+				left := hydrogensOnLeft(mol, hidden, i)
+				drawGroupLabel(dc, cfg, GroupLabelText(a.Label, left), i, x, y, left)
+			} else {
+				drawAtomLabel(dc, cfg, a, i, x, y, labelHydrogens(mol, hidden, i), hydrogensOnLeft(mol, hidden, i))
+			}
 			// 手性星号靠左
 			if cfg.ShownChiral[i+1] {
 				s := "*"
 				w2, _ := dc.MeasureString(s)
+				dc.SetHexColor(cfg.Theme.Marker)
 				dc.DrawString(s, x-cfg.LabelLeft[i]-w2/2, y)
 				cfg.LabelLeft[i] += w2
 			}
-			// **可按需扩展：电荷、显式氢等，参考 Java 版**
+			dc.SetHexColor(cfg.Theme.Bond)
 		}
 	}
 
 	// 2) 绘制键（Bond）
-	for _, b := range mol.Bonds {
-		x1 := cfg.FontSize + cfg.ScaleFactor*(mol.Atoms[b.From].X-mol.MinX())
+	rings, bondRing := mol.BondRings()
+	aromatic := make([]bool, len(rings))
+	var kekule map[int]int
+	if cfg.AromaticCircles {
+		for ri, ring := range rings {
+			aromatic[ri] = mol.IsAromaticRing(ring) || allBondsAromatic(mol, ring)
+		}
+	} else {
+		kekule = mol.KekuleOrders()
+	}
+	for bi, b := range mol.Bonds {
+		if hidden[b.From] || hidden[b.To] {
+			continue
+		}
+		x1 := cfg.OffsetX + cfg.FontSize + cfg.ScaleFactor*(mol.Atoms[b.From].X-mol.MinX())
 		y1 := float64(cfg.Height) - cfg.FontSize - cfg.ScaleFactor*(mol.Atoms[b.From].Y-mol.MinY())
-		x2 := cfg.FontSize + cfg.ScaleFactor*(mol.Atoms[b.To].X-mol.MinX())
+		x2 := cfg.OffsetX + cfg.FontSize + cfg.ScaleFactor*(mol.Atoms[b.To].X-mol.MinX())
 		y2 := float64(cfg.Height) - cfg.FontSize - cfg.ScaleFactor*(mol.Atoms[b.To].Y-mol.MinY())
 		p1 := calcLinePointConfined(x1, y1, x2, y2,
 			cfg.LabelLeft[b.From], cfg.LabelRight[b.From], cfg.LabelTop[b.From], cfg.LabelBottom[b.From])
@@ -179,12 +246,31 @@ func doDrawMolecule(dc *gg.Context, mol *Molecule, cfg *MoleculeRenderConfig) {
 		delta := cfg.FontSize / 6
 		dxOff := math.Sin(rad) * delta
 		dyOff := -math.Cos(rad) * delta
-		switch b.Order {
+		order := b.Order
+		ring := bondRing[bi]
+		// 芳香环画内切圆，环上的键都按单键画；不画内圆时芳香键换成 Kekulé 式的单双键
+		if order == 4 && !cfg.AromaticCircles {
+			order = kekule[bi]
+		} else if order == 4 || (ring >= 0 && aromatic[ring]) {
+			order = 1
+		}
+		switch order {
 		case 1:
 			dc.DrawLine(p1.X, p1.Y, p2.X, p2.Y)
 		case 2:
-			dc.DrawLine(p1.X+dxOff/2, p1.Y+dyOff/2, p2.X+dxOff/2, p2.Y+dyOff/2)
-			dc.DrawLine(p1.X-dxOff/2, p1.Y-dyOff/2, p2.X-dxOff/2, p2.Y-dyOff/2)
+			side := doubleBondSide(mol, cfg, bi, ring, rings)
+			if side == 0 {
+				// 末端 C=O 这类双键：关于键轴对称
+				dc.DrawLine(p1.X+dxOff/2, p1.Y+dyOff/2, p2.X+dxOff/2, p2.Y+dyOff/2)
+				dc.DrawLine(p1.X-dxOff/2, p1.Y-dyOff/2, p2.X-dxOff/2, p2.Y-dyOff/2)
+			} else {
+				// 环内/链中双键：主线在键轴上，第二条线偏向 side 一侧并缩短
+				dc.DrawLine(p1.X, p1.Y, p2.X, p2.Y)
+				ox, oy := side*dxOff, side*dyOff
+				sx := (p2.X - p1.X) * doubleBondShrink
+				sy := (p2.Y - p1.Y) * doubleBondShrink
+				dc.DrawLine(p1.X+ox+sx, p1.Y+oy+sy, p2.X+ox-sx, p2.Y+oy-sy)
+			}
 		case 3:
 			dc.DrawLine(p1.X, p1.Y, p2.X, p2.Y)
 			dc.DrawLine(p1.X+dxOff, p1.Y+dyOff, p2.X+dxOff, p2.Y+dyOff)
@@ -192,10 +278,126 @@ func doDrawMolecule(dc *gg.Context, mol *Molecule, cfg *MoleculeRenderConfig) {
 		}
 		dc.Stroke()
 	}
+
+	// 3) 芳香环内圆
+	for ri, ring := range rings {
+		if !aromatic[ri] {
+			continue
+		}
+		cx, cy, r := ringCircle(mol, cfg, ring)
+		dc.DrawCircle(cx, cy, r)
+		dc.Stroke()
+	}
+}
+
+// doubleBondShrink 偏移的第二条线两端各缩短键长的比例
+const doubleBondShrink = 0.15
+
+// doubleBondSide 决定双键第二条线画在哪一侧：+1 / -1 对应 doDrawMolecule 中的法向 (dxOff, dyOff)，
+// 0 表示对称画法。环上双键偏向环心；链中双键偏向取代基更多的一侧；末端双键对称。
+func doubleBondSide(mol *Molecule, cfg *MoleculeRenderConfig, bi, ring int, rings [][]int) float64 {
+	b := mol.Bonds[bi]
+	px := func(i int) (float64, float64) {
+		a := mol.Atoms[i]
+		return cfg.OffsetX + cfg.FontSize + cfg.ScaleFactor*(a.X-mol.MinX()),
+			float64(cfg.Height) - cfg.FontSize - cfg.ScaleFactor*(a.Y-mol.MinY())
+	}
+	x1, y1 := px(b.From)
+	x2, y2 := px(b.To)
+	rad := math.Atan2(y2-y1, x2-x1)
+	nx, ny := math.Sin(rad), -math.Cos(rad)
+	sideOf := func(x, y float64) float64 {
+		d := (x-x1)*nx + (y-y1)*ny
+		switch {
+		case d > 1e-6:
+			return 1
+		case d < -1e-6:
+			return -1
+		}
+		return 0
+	}
+
+	if ring >= 0 {
+		var cx, cy float64
+		for _, ai := range rings[ring] {
+			x, y := px(ai)
+			cx += x
+			cy += y
+		}
+		n := float64(len(rings[ring]))
+		return sideOf(cx/n, cy/n)
+	}
+
+	// 链中双键：统计两端其它邻居落在哪一侧
+	mol.buildCaches()
+	sum := 0.0
+	neighbours := 0
+	for _, end := range []int{b.From, b.To} {
+		for _, bid := range mol.atomBondMap[end] {
+			if bid-1 == bi {
+				continue
+			}
+			o := mol.Bonds[bid-1]
+			other := o.From
+			if other == end {
+				other = o.To
+			}
+			x, y := px(other)
+			sum += sideOf(x, y)
+			neighbours++
+		}
+	}
+	if neighbours == 0 || len(mol.atomBondMap[b.From]) == 1 || len(mol.atomBondMap[b.To]) == 1 {
+		return 0
+	}
+	switch {
+	case sum > 0:
+		return 1
+	case sum < 0:
+		return -1
+	}
+	return 0
+}
+
+// allBondsAromatic 环上所有键都是 order 4 芳香键（画内圆时不论环大小都画圆）
+func allBondsAromatic(mol *Molecule, ring []int) bool {
+	for i := range ring {
+		bi := mol.FindBond(ring[i], ring[(i+1)%len(ring)])
+		if bi < 0 || mol.Bonds[bi].Order != 4 {
+			return false
+		}
+	}
+	return true
 }
 
-// 点结构体，用于裁剪线段端点
-type Point struct{ X, Y float64 }
+// ringCircle 芳香环内圆：圆心为环原子像素坐标的平均值，半径取到各边距离最小值的 0.6 倍
+func ringCircle(mol *Molecule, cfg *MoleculeRenderConfig, ring []int) (cx, cy, r float64) {
+	pts := make([]Point, len(ring))
+	for i, ai := range ring {
+		a := mol.Atoms[ai]
+		pts[i] = Point{
+			X: cfg.OffsetX + cfg.FontSize + cfg.ScaleFactor*(a.X-mol.MinX()),
+			Y: float64(cfg.Height) - cfg.FontSize - cfg.ScaleFactor*(a.Y-mol.MinY()),
+		}
+		cx += pts[i].X
+		cy += pts[i].Y
+	}
+	cx /= float64(len(pts))
+	cy /= float64(len(pts))
+	r = math.MaxFloat64
+	for i := range pts {
+		p, q := pts[i], pts[(i+1)%len(pts)]
+		// 圆心到边 pq 的距离
+		ex, ey := q.X-p.X, q.Y-p.Y
+		l := math.Hypot(ex, ey)
+		if l == 0 {
+			continue
+		}
+		d := math.Abs((cx-p.X)*ey-(cy-p.Y)*ex) / l
+		r = math.Min(r, d)
+	}
+	return cx, cy, r * 0.6
+}
 
 // calcLinePointConfined 对应 Java calcLinePointConfined
 func calcLinePointConfined(x, y, x2, y2, left, right, top, bottom float64) Point {
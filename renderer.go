@@ -0,0 +1,196 @@
+// File: renderer.go
+package main
+
+import (
+	"fmt"
+	"html"
+	"image/png"
+	"io"
+	"strings"
+
+	"github.com/fogleman/gg"
+)
+
+// 输出格式
+const (
+	FormatPNG = "png"
+	FormatSVG = "svg"
+)
+
+// Renderer 绘图后端抽象，方法名与 gg.Context 保持一致，
+// 这样 drawGridBackground / doDrawMolecule 对 PNG 和 SVG 共用同一套绘制逻辑
+type Renderer interface {
+	SetRGB(r, g, b float64)
+	SetHexColor(x string)
+	SetLineWidth(w float64)
+	// SetFont 切换到已注册字体族（见 fonts.go）的指定字号，未注册的族回退到默认字体
+	SetFont(family string, points float64)
+	FontHeight() float64
+	MeasureString(s string) (w, h float64)
+	DrawString(s string, x, y float64)
+	DrawStringAnchored(s string, x, y, ax, ay float64)
+	DrawLine(x1, y1, x2, y2 float64)
+	DrawRectangle(x, y, w, h float64)
+	DrawCircle(x, y, r float64)
+	Stroke()
+	Fill()
+	Clear()
+	// Encode 把画好的图写出（PNG 字节或 SVG 文档）
+	Encode(w io.Writer) error
+}
+
+// newRenderer 按格式创建后端，空字符串按 PNG 处理
+func newRenderer(format string, width, height int) (Renderer, error) {
+	switch format {
+	case "", FormatPNG:
+		return &pngRenderer{Context: gg.NewContext(width, height), faces: make(faceCache)}, nil
+	case FormatSVG:
+		return newSVGRenderer(width, height), nil
+	}
+	return nil, fmt.Errorf("unsupported image format %q", format)
+}
+
+// ImageMIMEType returns the MIME type used in data URIs for format.
+func ImageMIMEType(format string) string {
+	if format == FormatSVG {
+		return "image/svg+xml"
+	}
+	return "image/png"
+}
+
+// pngRenderer gg 光栅后端
+type pngRenderer struct {
+	*gg.Context
+	faces faceCache
+}
+
+func (r *pngRenderer) SetFont(family string, points float64) {
+	r.SetFontFace(r.faces.face(family, points))
+}
+
+func (r *pngRenderer) Encode(w io.Writer) error {
+	return png.Encode(w, r.Image())
+}
+
+// svgRenderer 矢量后端。文字度量借用一个 1x1 的 gg.Context，保证标签留白与 PNG 一致。
+// 字体不嵌入 SVG，浏览器用系统的 sans-serif/monospace 显示，字宽与度量可能略有出入
+type svgRenderer struct {
+	width, height int
+	measure       *gg.Context
+	faces         faceCache
+
+	color      string
+	lineWidth  float64
+	fontSize   float64
+	fontCSS    string
+	fontWeight string          // font-weight，空为默认
+	path       strings.Builder // 当前未 Stroke/Fill 的路径
+	body       strings.Builder
+}
+
+func newSVGRenderer(width, height int) *svgRenderer {
+	return &svgRenderer{
+		width:     width,
+		height:    height,
+		measure:   gg.NewContext(1, 1),
+		faces:     make(faceCache),
+		color:     "#000000",
+		lineWidth: 1,
+		fontSize:  13, // gg 默认字体高度
+		fontCSS:   "sans-serif",
+	}
+}
+
+func (r *svgRenderer) SetRGB(red, green, blue float64) {
+	r.color = fmt.Sprintf("#%02X%02X%02X", clampByte(red), clampByte(green), clampByte(blue))
+}
+
+func (r *svgRenderer) SetHexColor(x string) {
+	if !strings.HasPrefix(x, "#") {
+		x = "#" + x
+	}
+	r.color = x
+}
+
+func (r *svgRenderer) SetLineWidth(w float64) { r.lineWidth = w }
+
+func (r *svgRenderer) SetFont(family string, points float64) {
+	r.fontSize = points
+	fam := lookupFontFamily(family)
+	r.fontCSS, r.fontWeight = fam.css, fam.weight
+	r.measure.SetFontFace(r.faces.face(family, points))
+}
+
+func (r *svgRenderer) FontHeight() float64 { return r.measure.FontHeight() }
+
+func (r *svgRenderer) MeasureString(s string) (w, h float64) {
+	return r.measure.MeasureString(s)
+}
+
+func (r *svgRenderer) DrawString(s string, x, y float64) {
+	weight := ""
+	if r.fontWeight != "" {
+		weight = ` font-weight="` + html.EscapeString(r.fontWeight) + `"`
+	}
+	fmt.Fprintf(&r.body, `<text x="%.2f" y="%.2f" font-family="%s"%s font-size="%.2f" fill="%s">%s</text>`+"\n",
+		x, y, html.EscapeString(r.fontCSS), weight, r.fontSize, r.color, html.EscapeString(s))
+}
+
+// DrawStringAnchored 与 gg 相同：x -= ax*w, y += ay*h
+func (r *svgRenderer) DrawStringAnchored(s string, x, y, ax, ay float64) {
+	w, h := r.MeasureString(s)
+	r.DrawString(s, x-ax*w, y+ay*h)
+}
+
+func (r *svgRenderer) DrawLine(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(&r.path, "M%.2f %.2fL%.2f %.2f", x1, y1, x2, y2)
+}
+
+func (r *svgRenderer) DrawRectangle(x, y, w, h float64) {
+	fmt.Fprintf(&r.path, "M%.2f %.2fh%.2fv%.2fh%.2fZ", x, y, w, h, -w)
+}
+
+func (r *svgRenderer) DrawCircle(x, y, radius float64) {
+	fmt.Fprintf(&r.path, "M%.2f %.2fA%.2f %.2f 0 1 0 %.2f %.2fA%.2f %.2f 0 1 0 %.2f %.2fZ",
+		x+radius, y, radius, radius, x-radius, y, radius, radius, x+radius, y)
+}
+
+func (r *svgRenderer) Stroke() {
+	if r.path.Len() == 0 {
+		return
+	}
+	fmt.Fprintf(&r.body, `<path d="%s" fill="none" stroke="%s" stroke-width="%.2f" stroke-linecap="round"/>`+"\n",
+		r.path.String(), r.color, r.lineWidth)
+	r.path.Reset()
+}
+
+func (r *svgRenderer) Fill() {
+	if r.path.Len() == 0 {
+		return
+	}
+	fmt.Fprintf(&r.body, `<path d="%s" fill="%s"/>`+"\n", r.path.String(), r.color)
+	r.path.Reset()
+}
+
+func (r *svgRenderer) Clear() {
+	r.body.Reset()
+	r.path.Reset()
+	fmt.Fprintf(&r.body, `<rect width="%d" height="%d" fill="%s"/>`+"\n", r.width, r.height, r.color)
+}
+
+func (r *svgRenderer) Encode(w io.Writer) error {
+	_, err := fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n%s</svg>\n",
+		r.width, r.height, r.width, r.height, r.body.String())
+	return err
+}
+
+func clampByte(v float64) int {
+	n := int(v*255 + 0.5)
+	if n < 0 {
+		return 0
+	}
+	if n > 255 {
+		return 255
+	}
+	return n
+}
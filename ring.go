@@ -0,0 +1,169 @@
+// File: ring.go
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// BondRings 为每根键找出包含它的最小环（BFS 最短回路）。
+// rings 中每个环按环上顺序列出原子（0-based），已去重；
+// bondRing[i] 为第 i 根键所在最小环在 rings 中的下标，不在环上为 -1。
+func (m *Molecule) BondRings() (rings [][]int, bondRing []int) {
+	m.buildCaches()
+	bondRing = make([]int, len(m.Bonds))
+	seen := make(map[string]int)
+	for i, b := range m.Bonds {
+		bondRing[i] = -1
+		path := m.shortestPathAvoiding(b.From, b.To, i)
+		if path == nil {
+			continue
+		}
+		key := ringKey(path)
+		idx, ok := seen[key]
+		if !ok {
+			idx = len(rings)
+			seen[key] = idx
+			rings = append(rings, path)
+		}
+		bondRing[i] = idx
+	}
+	return rings, bondRing
+}
+
+// shortestPathAvoiding 在不经过键 skip（0-based）的前提下求 from→to 的最短路径
+func (m *Molecule) shortestPathAvoiding(from, to, skip int) []int {
+	prev := make([]int, len(m.Atoms))
+	for i := range prev {
+		prev[i] = -1
+	}
+	prev[from] = from
+	queue := []int{from}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		if cur == to {
+			break
+		}
+		for _, bid := range m.atomBondMap[cur] {
+			if bid-1 == skip {
+				continue
+			}
+			b := m.Bonds[bid-1]
+			next := b.From
+			if next == cur {
+				next = b.To
+			}
+			if prev[next] == -1 {
+				prev[next] = cur
+				queue = append(queue, next)
+			}
+		}
+	}
+	if prev[to] == -1 {
+		return nil
+	}
+	var path []int
+	for at := to; at != from; at = prev[at] {
+		path = append(path, at)
+	}
+	return append(path, from)
+}
+
+// ringKey 环原子集合的规范键，用于去重
+func ringKey(ring []int) string {
+	sorted := append([]int(nil), ring...)
+	sort.Ints(sorted)
+	return fmt.Sprint(sorted)
+}
+
+// IsAromaticRing 判断环能否按芳香环绘制：5~7 元环，所有环键为芳香键（order 4），
+// 或 6 元环单双键交替（Kekulé 式苯环）
+func (m *Molecule) IsAromaticRing(ring []int) bool {
+	n := len(ring)
+	if n < 5 || n > 7 {
+		return false
+	}
+	allAromatic := true
+	doubles := 0
+	lastOrder := 0
+	alternating := true
+	for i := range ring {
+		bi := m.FindBond(ring[i], ring[(i+1)%n])
+		if bi < 0 {
+			return false
+		}
+		order := m.Bonds[bi].Order
+		if order != 4 {
+			allAromatic = false
+		}
+		if order == 2 {
+			doubles++
+		}
+		if i > 0 && order == lastOrder {
+			alternating = false
+		}
+		lastOrder = order
+	}
+	if allAromatic {
+		return true
+	}
+	return n == 6 && doubles == 3 && alternating
+}
+
+// kekuleBudget KekuleOrders 回溯的步数上限，超出后用已找到的最好结果
+const kekuleBudget = 20000
+
+// KekuleOrders 给芳香键（order 4）分配单双键：在芳香键组成的子图上找双键尽量多、且每个原子
+// 至多一个双键的匹配，返回键下标 → 1 或 2。已有环外双键的原子不再分配双键，
+// 吡咯 N、呋喃 O 这类原子在最大匹配里自然落空。不关芳香内圆时用它把芳香环画成 Kekulé 式。
+func (m *Molecule) KekuleOrders() map[int]int {
+	m.buildCaches()
+	var bonds []int
+	busy := make([]bool, len(m.Atoms))
+	for bi, b := range m.Bonds {
+		if b.Order == 4 {
+			bonds = append(bonds, bi)
+		} else if b.Order == 2 {
+			busy[b.From], busy[b.To] = true, true
+		}
+	}
+	if len(bonds) == 0 {
+		return nil
+	}
+
+	chosen := make([]bool, len(bonds))
+	best := make([]bool, len(bonds))
+	bestN, steps := -1, 0
+	var search func(i, n int)
+	search = func(i, n int) {
+		steps++
+		if n+(len(bonds)-i) <= bestN || steps > kekuleBudget {
+			return
+		}
+		if i == len(bonds) {
+			bestN = n
+			copy(best, chosen)
+			return
+		}
+		b := m.Bonds[bonds[i]]
+		if !busy[b.From] && !busy[b.To] {
+			busy[b.From], busy[b.To] = true, true
+			chosen[i] = true
+			search(i+1, n+1)
+			chosen[i] = false
+			busy[b.From], busy[b.To] = false, false
+		}
+		search(i+1, n)
+	}
+	search(0, 0)
+
+	orders := make(map[int]int, len(bonds))
+	for i, bi := range bonds {
+		orders[bi] = 1
+		if best[i] {
+			orders[bi] = 2
+		}
+	}
+	return orders
+}
@@ -0,0 +1,67 @@
+// File: ring_test.go
+package main
+
+import "testing"
+
+func TestKekuleOrders(t *testing.T) {
+	tests := []struct {
+		name    string
+		n       int      // 环原子数，环键都是芳香键
+		extra   [][2]int // 额外的芳香键（稠环桥键）
+		exo     bool     // 0 号原子带环外双键
+		doubles int
+	}{
+		{"benzene", 6, nil, false, 3},
+		{"pyrrole ring", 5, nil, false, 2},
+		{"naphthalene", 10, [][2]int{{0, 5}}, false, 5},
+		{"exocyclic double bond", 6, nil, true, 2},
+	}
+	for _, tt := range tests {
+		m := &Molecule{}
+		for i := 0; i < tt.n; i++ {
+			m.AddAtom(Atom{Element: "C"})
+		}
+		for i := 0; i < tt.n; i++ {
+			if _, err := m.AddBond(i, (i+1)%tt.n, 4); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, b := range tt.extra {
+			if _, err := m.AddBond(b[0], b[1], 4); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if tt.exo {
+			o := m.AddAtom(Atom{Element: "O"})
+			if _, err := m.AddBond(0, o, 2); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		orders := m.KekuleOrders()
+		doubles := make([]int, len(m.Atoms))
+		n := 0
+		for bi, b := range m.Bonds {
+			if b.Order != 4 {
+				continue
+			}
+			switch orders[bi] {
+			case 2:
+				n++
+				doubles[b.From]++
+				doubles[b.To]++
+			case 1:
+			default:
+				t.Errorf("%s: bond %d order %d", tt.name, bi, orders[bi])
+			}
+		}
+		if n != tt.doubles {
+			t.Errorf("%s: %d double bonds, want %d", tt.name, n, tt.doubles)
+		}
+		for i, d := range doubles {
+			if d > 1 || (tt.exo && i == 0 && d > 0) {
+				t.Errorf("%s: atom %d has %d aromatic double bonds", tt.name, i, d)
+			}
+		}
+	}
+}
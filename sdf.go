@@ -13,77 +13,52 @@ import (
 )
 
 type Atom struct {
-	X, Y    float64
+	X, Y, Z float64 // Z 只有 3D 构象 SDF 才非零
 	Element string
 	HCount  int
+	Isotope int    // 质量数，0 表示天然丰度
+	Charge  int    // 形式电荷
+	Label   string // 缩写基团标签（Ph、Boc…，见 abbrev.go），非空时代替元素符号绘制
 }
 
 type Bond struct {
 	From, To, Order int
+	Stereo          int // V2000 键立体标记：1 楔形（实）、6 楔形（虚）、4 不确定，相对 From 原子
 }
 
 type Molecule struct {
 	Atoms []Atom
 	Bonds []Bond
 
-	// —— 新增缓存 ——
-	bondIDMap   map[Bond]int  // Bond→1-based ID
+	// IgnoreIsotopes 为 true 时手性判断不区分同位素（CHDT 不再算手性）
+	IgnoreIsotopes bool
+
+	// —— 新增缓存 ——（修改原子/键后须调用 invalidateCaches，见 molecule.go）
 	atomBondMap map[int][]int // atom 0-based idx → list of bond‐indices (1-based)
 	chainTTL    int
 }
 
+// DefaultIgnoreIsotopes 解析出的分子 IgnoreIsotopes 的初值。服务端用 CHIRAL_IGNORE_ISOTOPES=1 设置，
+// 索引生成器和 validate 子命令用 -ignore-isotopes 参数；生成索引与出题时应保持一致，
+// 否则索引中只靠同位素成为手性的分子出题时会找不到手性碳
+var DefaultIgnoreIsotopes = false
+
 func pickRandomOffset(offsets []int64) int64 {
 	src := rand.NewSource(time.Now().UnixNano())
 	r := rand.New(src)
 	return offsets[r.Intn(len(offsets))]
 }
 
-// ParseSDF 只读第一个分子，支持 V2000 格式
+// ParseSDF 只读第一个分子，支持 V2000 格式。与索引生成器、validate 和出题共用 ParseMolString，
+// 同位素（mass difference、M  ISO）、电荷和键立体标记的解析保持一致
 func ParseSDF(path string) (*Molecule, error) {
-	f, err := os.Open(path)
+	molStr, err := readMolAt(path, 0)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
-	sc := bufio.NewScanner(f)
-	// 跳过三行 header
-	for i := 0; i < 3; i++ {
-		if !sc.Scan() {
-			return nil, fmt.Errorf("unexpected EOF in header")
-		}
-	}
-	// counts line
-	if !sc.Scan() {
-		return nil, fmt.Errorf("missing counts line")
-	}
-	cnt := sc.Text()
-	atomCount, _ := strconv.Atoi(strings.TrimSpace(cnt[0:3]))
-	bondCount, _ := strconv.Atoi(strings.TrimSpace(cnt[3:6]))
-
-	mol := &Molecule{
-		Atoms: make([]Atom, atomCount),
-		Bonds: make([]Bond, bondCount),
-	}
-	// atom block
-	for i := 0; i < atomCount; i++ {
-		sc.Scan()
-		line := sc.Text()
-		x, _ := strconv.ParseFloat(strings.TrimSpace(line[0:10]), 64)
-		y, _ := strconv.ParseFloat(strings.TrimSpace(line[10:20]), 64)
-		elem := strings.TrimSpace(line[31:34])
-		mol.Atoms[i] = Atom{X: x, Y: y, Element: elem, HCount: 0}
-	}
-	// bond block
-	for i := 0; i < bondCount; i++ {
-		sc.Scan()
-		line := sc.Text()
-		fIdx, _ := strconv.Atoi(strings.TrimSpace(line[0:3]))
-		tIdx, _ := strconv.Atoi(strings.TrimSpace(line[3:6]))
-		order, _ := strconv.Atoi(strings.TrimSpace(line[6:9]))
-		mol.Bonds[i] = Bond{From: fIdx - 1, To: tIdx - 1, Order: order}
-	}
-	return mol, nil
+	return ParseMolString(molStr)
 }
+
 func parseRandomMolFromFile(sdfPath string) (*Molecule, error) {
 	idxPath := strings.TrimSuffix(sdfPath, ".sdf") + ".index"
 	offsets, err := loadIndex(idxPath)
@@ -137,11 +112,26 @@ func ParseMolString(str string) (*Molecule, error) {
 		if len(l) < 39 {
 			continue
 		}
-		atoms = append(atoms, Atom{
+		atom := Atom{
 			X:       parseFloatSafe(l[0:10]),
 			Y:       parseFloatSafe(l[10:20]),
+			Z:       parseFloatSafe(l[20:30]),
 			Element: strings.TrimSpace(l[31:34]),
-		})
+		}
+		// 旧式 mass difference 字段（dd，34-35 列），会被 M  ISO 覆盖
+		if len(l) >= 36 {
+			if dd := parseIntSafe(l[34:36]); dd != 0 {
+				if mass, ok := standardMass[atom.Element]; ok {
+					atom.Isotope = mass + dd
+				}
+			}
+		}
+		// 旧式电荷字段（ccc，36-38 列），会被 M  CHG 覆盖
+		if len(l) >= 39 {
+			atom.Charge = atomBlockCharge(parseIntSafe(l[36:39]))
+		}
+		normalizeHydrogenIsotope(&atom)
+		atoms = append(atoms, atom)
 	}
 
 	for i := 0; i < numBonds; i++ {
@@ -150,18 +140,100 @@ func ParseMolString(str string) (*Molecule, error) {
 			continue
 		}
 		bonds = append(bonds, Bond{
-			From:  parseIntSafe(l[0:3]) - 1,
-			To:    parseIntSafe(l[3:6]) - 1,
-			Order: parseIntSafe(l[6:9]),
+			From:   parseIntSafe(l[0:3]) - 1,
+			To:     parseIntSafe(l[3:6]) - 1,
+			Order:  parseIntSafe(l[6:9]),
+			Stereo: parseIntSafe(l[9:12]),
 		})
 	}
 
+	// 属性块：处理 M  ISO / M  CHG
+	if len(lines) > numAtoms+numBonds {
+		chgSeen := false
+		for _, l := range lines[numAtoms+numBonds:] {
+			if strings.HasPrefix(l, "M  END") {
+				break
+			}
+			if strings.HasPrefix(l, "M  ISO") {
+				applyIsoLine(l, atoms)
+			}
+			if strings.HasPrefix(l, "M  CHG") {
+				// 按 V2000 规范，出现 M  CHG 时忽略原子块里的电荷
+				if !chgSeen {
+					for i := range atoms {
+						atoms[i].Charge = 0
+					}
+					chgSeen = true
+				}
+				for _, p := range propertyPairs(l) {
+					if p[0] >= 1 && p[0] <= len(atoms) {
+						atoms[p[0]-1].Charge = p[1]
+					}
+				}
+			}
+		}
+	}
+
 	return &Molecule{
-		Atoms: atoms,
-		Bonds: bonds,
+		Atoms:          atoms,
+		Bonds:          bonds,
+		IgnoreIsotopes: DefaultIgnoreIsotopes,
 	}, nil
 }
 
+// standardMass 常见元素最丰同位素的质量数，用于换算 V2000 的 mass difference
+var standardMass = map[string]int{
+	"H": 1, "C": 12, "N": 14, "O": 16, "F": 19, "P": 31,
+	"S": 32, "Cl": 35, "Br": 79, "I": 127, "B": 11, "Si": 28,
+}
+
+// normalizeHydrogenIsotope 把 D/T 元素符号统一成带质量数的 H
+func normalizeHydrogenIsotope(a *Atom) {
+	switch a.Element {
+	case "D":
+		a.Element, a.Isotope = "H", 2
+	case "T":
+		a.Element, a.Isotope = "H", 3
+	}
+}
+
+// atomBlockCharge 把原子块 ccc 编码换算成形式电荷（4 为双自由基，按 0 处理）
+func atomBlockCharge(code int) int {
+	switch code {
+	case 1, 2, 3, 5, 6, 7:
+		return 4 - code
+	}
+	return 0
+}
+
+// propertyPairs 解析 "M  XXXnn8 aaa vvv ..." 形式属性行中的 (原子序号 1-based, 值) 对
+func propertyPairs(l string) [][2]int {
+	if len(l) < 9 {
+		return nil
+	}
+	fields := strings.Fields(l[9:])
+	var pairs [][2]int
+	for i := 0; i+1 < len(fields); i += 2 {
+		pairs = append(pairs, [2]int{parseIntSafe(fields[i]), parseIntSafe(fields[i+1])})
+	}
+	return pairs
+}
+
+// applyIsoLine 解析 "M  ISOnn8 aaa vvv ..."，把质量数写入对应原子（1-based）
+func applyIsoLine(l string, atoms []Atom) {
+	for _, p := range propertyPairs(l) {
+		idx, mass := p[0]-1, p[1]
+		if idx < 0 || idx >= len(atoms) {
+			continue
+		}
+		atoms[idx].Isotope = mass
+		// 质量数等于最丰同位素时按天然处理，避免 12C 与未标记碳不等价
+		if std, ok := standardMass[atoms[idx].Element]; ok && std == mass {
+			atoms[idx].Isotope = 0
+		}
+	}
+}
+
 func parseIntSafe(s string) int {
 	n := 0
 	fmt.Sscanf(strings.TrimSpace(s), "%d", &n)
@@ -185,13 +257,14 @@ func Hydrogenate(mol *Molecule) {
 		for _, b := range mol.GetAtomDeclaredBonds(ai + 1) {
 			totalBond += b.Order
 		}
+		// 形式电荷修正价态：C+/C- 为 3，N+ 为 4，O- 为 1
 		switch atom.Element {
 		case "C":
-			atom.HCount = max(0, 4-totalBond)
+			atom.HCount = max(0, 4-abs(atom.Charge)-totalBond)
 		case "O", "S":
-			atom.HCount = max(0, 2-totalBond)
+			atom.HCount = max(0, 2+atom.Charge-totalBond)
 		case "N", "P":
-			atom.HCount = max(0, 3-totalBond)
+			atom.HCount = max(0, 3+atom.Charge-totalBond)
 		// …按 Java initOnce 里相同的逻辑
 		default:
 			atom.HCount = hcnt
@@ -199,6 +272,13 @@ func Hydrogenate(mol *Molecule) {
 	}
 }
 
+func abs(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
 func max(a, b int) int {
 	if a > b {
 		return a
@@ -268,40 +348,10 @@ func readMolAt(sdfPath string, off int64) (string, error) {
 	return sb.String(), nil
 }
 func ParseMolAtOffset(sdfPath string, offset int64) (*Molecule, error) {
-	f, err := os.Open(sdfPath)
+	molStr, err := readMolAt(sdfPath, offset)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
-
-	if _, err := f.Seek(offset, io.SeekStart); err != nil {
-		return nil, err
-	}
-
-	reader := bufio.NewReader(f)
-	var sb strings.Builder
-
-	for {
-		line, err := reader.ReadString('\n')
-		if err != nil && err != io.EOF {
-			return nil, err
-		}
-		trimmed := strings.TrimSpace(line)
-		if trimmed == "$$$$" {
-			break // 读到 "$$$$" 结束（不包含）
-		}
-		sb.WriteString(line)
-		// 保持原来的换行
-		if !strings.HasSuffix(line, "\n") {
-			sb.WriteString("\n")
-		}
-		if err == io.EOF {
-			break
-		}
-	}
-
-	// 现在 sb.String() 是这个分子的 mol 字符串
-	molStr := sb.String()
 	return ParseMolString(molStr)
 }
 
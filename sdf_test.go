@@ -0,0 +1,54 @@
+// File: sdf_test.go
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// 带 M  ISO、M  CHG 和 3D 坐标的 CHDT 片段：C1 上连 D（M  ISO）、T（mass difference）、N+
+const isotopeMolBlock = `isotopes
+  test    3D
+
+  5  4  0  0  0  0  0  0  0  0999 V2000
+    0.0000    0.0000    0.0000 C   0  0  0  0  0  0  0  0  0  0  0  0
+    1.0000    0.0000    0.5000 H   0  0  0  0  0  0  0  0  0  0  0  0
+   -1.0000    0.0000    0.5000 H   2  0  0  0  0  0  0  0  0  0  0  0
+    0.0000    1.0000   -0.5000 N   0  0  0  0  0  0  0  0  0  0  0  0
+    0.0000   -1.0000   -0.5000 O   0  0  0  0  0  0  0  0  0  0  0  0
+  1  2  1  1
+  1  3  1  0
+  1  4  1  0
+  1  5  1  0
+M  ISO  1   2   2
+M  CHG  1   4   1
+M  END
+> <PUBCHEM_COMPOUND_CID>
+1
+
+$$$$
+`
+
+func TestParseSDFMatchesParseMolString(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "iso.sdf")
+	if err := os.WriteFile(path, []byte(isotopeMolBlock+isotopeMolBlock), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	fromFile, err := ParseSDF(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromString, err := ParseMolString(isotopeMolBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fromFile.Atoms, fromString.Atoms) || !reflect.DeepEqual(fromFile.Bonds, fromString.Bonds) {
+		t.Fatalf("ParseSDF and ParseMolString disagree:\n%+v\n%+v", fromFile, fromString)
+	}
+	a := fromFile.Atoms
+	if a[1].Isotope != 2 || a[2].Isotope != 3 || a[3].Charge != 1 || a[1].Z != 0.5 || fromFile.Bonds[0].Stereo != 1 {
+		t.Errorf("isotopes/charge/Z/stereo not parsed: %+v %+v", a, fromFile.Bonds)
+	}
+}
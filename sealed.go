@@ -0,0 +1,130 @@
+// File: sealed.go
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+)
+
+// sealedAAD 附加认证数据：令牌只能用于题目验证，改版时换掉即可让旧令牌全部失效
+const sealedAAD = "chiral-challenge-v1"
+
+// sealedClaims 封装在令牌中的内容：只有验证需要的答案，不含分子和图片
+type sealedClaims struct {
+	Mode    string   `json:"m"`
+	Answers []string `json:"a,omitempty"`
+	Points  []Point  `json:"p,omitempty"`
+	Radius  float64  `json:"r,omitempty"`
+	Expires int64    `json:"e"` // Unix 秒
+}
+
+// SealedStore 无状态题目存储：答案、过期时间经 AES-256-GCM 加密认证后作为题目 ID 发给客户端，
+// 验证时解开令牌核对。GCM 的随机 nonce 兼作令牌标识，验证过的记入重放缓存，保证一次性。
+// 多个实例共用同一密钥即可水平扩展；重放缓存是各实例自己的，需要严格一次性时应按题目 ID 做会话保持。
+// 重放缓存满时不淘汰记录，验证返回 ErrStoreFull，容量应不小于有效期内的出题量
+type SealedStore struct {
+	aead cipher.AEAD
+	ttl  time.Duration
+	seen *MemoryStore // 已验证令牌的 nonce，保留到令牌过期
+}
+
+// NewSealedStore derives the AES key from secret. An empty secret generates a random key,
+// which only works for a single instance and invalidates all tokens on restart.
+func NewSealedStore(secret string, ttl time.Duration, maxSeen int) (*SealedStore, error) {
+	var key [32]byte
+	if secret == "" {
+		if _, err := rand.Read(key[:]); err != nil {
+			return nil, err
+		}
+		log.Println("CHIRAL_SEAL_KEY not set, using a random key: tokens are not shared between instances or restarts")
+	} else {
+		key = sha256.Sum256([]byte(secret))
+	}
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &SealedStore{aead: aead, ttl: ttl, seen: NewMemoryStore(ttl, maxSeen, StoreShards)}, nil
+}
+
+// Issue seals the answers of c into a URL-safe token that serves as the challenge ID.
+func (s *SealedStore) Issue(c Challenge) (string, time.Time, error) {
+	expires := time.Now().Add(s.ttl)
+	plain, err := json.Marshal(sealedClaims{Mode: c.Mode, Answers: c.Answers, Points: c.Points, Radius: c.Radius, Expires: expires.Unix()})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", time.Time{}, err
+	}
+	sealed := s.aead.Seal(nonce, nonce, plain, []byte(sealedAAD))
+	return base64.RawURLEncoding.EncodeToString(sealed), time.Unix(expires.Unix(), 0), nil
+}
+
+// open 解开并校验令牌，返回题目与 nonce，题目的 Expires 为令牌失效的时间；
+// 伪造、篡改、过期的令牌一律按找不到处理
+func (s *SealedStore) open(id string) (Challenge, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(id)
+	if err != nil || len(raw) < s.aead.NonceSize()+s.aead.Overhead() {
+		return Challenge{}, "", ErrChallengeNotFound
+	}
+	nonce, ct := raw[:s.aead.NonceSize()], raw[s.aead.NonceSize():]
+	plain, err := s.aead.Open(nil, nonce, ct, []byte(sealedAAD))
+	if err != nil {
+		return Challenge{}, "", ErrChallengeNotFound
+	}
+	var cl sealedClaims
+	if err := json.Unmarshal(plain, &cl); err != nil {
+		return Challenge{}, "", ErrChallengeNotFound
+	}
+	if time.Now().Unix() > cl.Expires {
+		return Challenge{}, "", ErrChallengeNotFound
+	}
+	// 过期按整秒比较，令牌在 Expires 这一秒内仍然有效
+	expires := time.Unix(cl.Expires+1, 0)
+	return Challenge{Mode: cl.Mode, Answers: cl.Answers, Points: cl.Points, Radius: cl.Radius, Expires: expires}, string(nonce), nil
+}
+
+// Put 无状态存储不接受外部指定的 ID，应改用 Issue
+func (s *SealedStore) Put(id string, c Challenge) (time.Time, error) {
+	return time.Time{}, errors.New("sealed store issues its own challenge IDs")
+}
+
+func (s *SealedStore) Get(id string) (Challenge, error) {
+	c, _, err := s.open(id)
+	return c, err
+}
+
+// Consume 解开令牌并把 nonce 记入重放缓存，保留到令牌失效；同一令牌第二次验证返回 ErrChallengeNotFound，
+// 缓存已满时返回 ErrStoreFull
+func (s *SealedStore) Consume(id string) (Challenge, error) {
+	c, nonce, err := s.open(id)
+	if err != nil {
+		return Challenge{}, err
+	}
+	fresh, err := s.seen.PutNew(nonce, Challenge{Expires: c.Expires})
+	if err != nil {
+		return Challenge{}, err
+	}
+	if !fresh {
+		return Challenge{}, ErrChallengeNotFound
+	}
+	return c, nil
+}
+
+// Sweep 只清理重放缓存，令牌本身自带过期时间
+func (s *SealedStore) Sweep(now time.Time) (int, error) {
+	return s.seen.Sweep(now)
+}
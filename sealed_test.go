@@ -0,0 +1,109 @@
+// File: sealed_test.go
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestSealedStore(t *testing.T, secret string, ttl time.Duration, maxSeen int) *SealedStore {
+	t.Helper()
+	s, err := NewSealedStore(secret, ttl, maxSeen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func issue(t *testing.T, s *SealedStore, c Challenge) string {
+	t.Helper()
+	id, _, err := s.Issue(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestSealedStoreRoundTrip(t *testing.T) {
+	s := newTestSealedStore(t, "secret", time.Minute, 100)
+	in := Challenge{Mode: ModeClick, Points: []Point{{X: 1, Y: 2}}, Radius: 7}
+	id := issue(t, s, in)
+	got, err := s.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Mode != in.Mode || len(got.Points) != 1 || got.Points[0] != in.Points[0] || got.Radius != in.Radius {
+		t.Errorf("Get = %+v, want %+v", got, in)
+	}
+	if _, err := s.Consume(id); err != nil {
+		t.Fatalf("Consume: %v", err)
+	}
+}
+
+func TestSealedStoreRejectsBadTokens(t *testing.T) {
+	s := newTestSealedStore(t, "secret", time.Minute, 100)
+	id := issue(t, s, Challenge{Mode: ModeGrid, Answers: []string{"A1"}})
+
+	raw, _ := base64.RawURLEncoding.DecodeString(id)
+	raw[len(raw)-1] ^= 1
+	tampered := base64.RawURLEncoding.EncodeToString(raw)
+
+	other := newTestSealedStore(t, "other secret", time.Minute, 100)
+	expired := issue(t, newTestSealedStore(t, "secret", -2*time.Second, 100), Challenge{Mode: ModeGrid})
+
+	for name, tok := range map[string]string{
+		"tampered":  tampered,
+		"expired":   expired,
+		"garbage":   "not-a-token",
+		"empty":     "",
+		"truncated": id[:10],
+	} {
+		if _, err := s.Consume(tok); !errors.Is(err, ErrChallengeNotFound) {
+			t.Errorf("%s: err = %v, want ErrChallengeNotFound", name, err)
+		}
+	}
+	if _, err := other.Consume(id); !errors.Is(err, ErrChallengeNotFound) {
+		t.Errorf("wrong key: err = %v, want ErrChallengeNotFound", err)
+	}
+}
+
+func TestSealedStoreReplay(t *testing.T) {
+	s := newTestSealedStore(t, "secret", time.Minute, 100)
+	id := issue(t, s, Challenge{Mode: ModeGrid})
+	if _, err := s.Consume(id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Consume(id); !errors.Is(err, ErrChallengeNotFound) {
+		t.Errorf("replay: err = %v, want ErrChallengeNotFound", err)
+	}
+}
+
+// 重放缓存满了不能靠淘汰旧记录腾位置，否则验证过的令牌可以再用一次
+func TestSealedStoreReplayCacheFailsClosed(t *testing.T) {
+	const max = 8
+	s := newTestSealedStore(t, "secret", time.Minute, max)
+	solved := issue(t, s, Challenge{Mode: ModeGrid})
+	if _, err := s.Consume(solved); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < max; i++ {
+		if _, err := s.Consume(issue(t, s, Challenge{Mode: ModeGrid})); err != nil {
+			t.Fatalf("filling cache, token %d: %v", i, err)
+		}
+	}
+	if _, err := s.Consume(issue(t, s, Challenge{Mode: ModeGrid})); !errors.Is(err, ErrStoreFull) {
+		t.Errorf("cache full: err = %v, want ErrStoreFull", err)
+	}
+	if _, err := s.Consume(solved); !errors.Is(err, ErrChallengeNotFound) {
+		t.Errorf("replay after filling cache: err = %v, want ErrChallengeNotFound", err)
+	}
+}
+
+func TestSealedStoreRejectsPut(t *testing.T) {
+	s := newTestSealedStore(t, "secret", time.Minute, 100)
+	if _, err := s.Put("id", Challenge{}); err == nil {
+		t.Error("Put succeeded on a sealed store")
+	}
+}
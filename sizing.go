@@ -0,0 +1,82 @@
+// File: sizing.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrMoleculeTooLarge 分子在最小可读键长下仍放不进画布上限，调用方应换一个分子
+var ErrMoleculeTooLarge = errors.New("molecule does not fit the canvas at the minimum bond length")
+
+// RenderSizing 以键长驱动的尺寸设置，单位均为 1x 像素
+type RenderSizing struct {
+	Bond    float64 // 目标平均键长
+	MinBond float64 // 最小可读键长：大分子按画布上限缩小，但不小于此值
+	MaxSize int     // 分子部分的最大边长（不含四周留白）
+}
+
+// DefaultRenderSizing 站点默认尺寸
+var DefaultRenderSizing = RenderSizing{Bond: 40, MinBond: 24, MaxSize: 600}
+
+// 输出倍率上限：1x/2x/3x
+const maxRenderScale = 3
+
+// SizedRenderConfig 按平均键长确定缩放：小分子不会被放大成粗线大字，大分子先按 MaxSize 缩小，
+// 键长低于 MinBond 时返回 ErrMoleculeTooLarge。字号与键长的比例沿用 Java 版（键长/1.8）
+func SizedRenderConfig(mol *Molecule, sz RenderSizing, gridX, gridY int) (*MoleculeRenderConfig, error) {
+	avgBond := mol.AverageBondLength()
+	if avgBond == 0 {
+		return nil, fmt.Errorf("molecule has no bonds")
+	}
+	scale := sz.Bond / avgBond
+	if rx := mol.RangeX(); rx > 0 {
+		scale = math.Min(scale, float64(sz.MaxSize)/rx)
+	}
+	if ry := mol.RangeY(); ry > 0 {
+		scale = math.Min(scale, float64(sz.MaxSize)/ry)
+	}
+	bond := avgBond * scale
+	if bond < sz.MinBond {
+		return nil, ErrMoleculeTooLarge
+	}
+	return newRenderConfig(mol, scale, bond/1.8, gridX, gridY), nil
+}
+
+// clone 复制渲染配置；标签边界在绘制时改写，每次绘制必须各自一份
+func (cfg *MoleculeRenderConfig) clone() *MoleculeRenderConfig {
+	c := *cfg
+	n := len(cfg.LabelLeft)
+	c.LabelLeft = make([]float64, n)
+	c.LabelRight = make([]float64, n)
+	c.LabelTop = make([]float64, n)
+	c.LabelBottom = make([]float64, n)
+	return &c
+}
+
+// Scaled returns a copy of cfg that draws the same layout at s× pixel density.
+// 所有像素量等比放大，格子划分与原子所在格子和 1x 完全一致
+func (cfg *MoleculeRenderConfig) Scaled(s int) *MoleculeRenderConfig {
+	c := cfg.clone()
+	f := float64(s)
+	c.Width *= s
+	c.Height *= s
+	c.FontSize *= f
+	c.ScaleFactor *= f
+	c.OffsetX *= f
+	if c.Debug != nil && c.Debug.Radius > 0 {
+		d := *c.Debug
+		d.Radius *= f
+		c.Debug = &d
+	}
+	return c
+}
+
+// CheckRenderScale reports whether s is a supported output scale (1..3).
+func CheckRenderScale(s int) error {
+	if s < 1 || s > maxRenderScale {
+		return fmt.Errorf("scale must be within 1..%d", maxRenderScale)
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+// File: stereo3d.go
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Vec3 三维向量，用于 3D 构象坐标
+type Vec3 struct{ X, Y, Z float64 }
+
+func (a Vec3) Sub(b Vec3) Vec3 { return Vec3{a.X - b.X, a.Y - b.Y, a.Z - b.Z} }
+func (a Vec3) Dot(b Vec3) float64 {
+	return a.X*b.X + a.Y*b.Y + a.Z*b.Z
+}
+func (a Vec3) Cross(b Vec3) Vec3 {
+	return Vec3{a.Y*b.Z - a.Z*b.Y, a.Z*b.X - a.X*b.Z, a.X*b.Y - a.Y*b.X}
+}
+func (a Vec3) Norm() float64 { return math.Sqrt(a.Dot(a)) }
+func (a Vec3) Normalize() Vec3 {
+	n := a.Norm()
+	if n == 0 {
+		return a
+	}
+	return Vec3{a.X / n, a.Y / n, a.Z / n}
+}
+
+// Pos returns the atom position as a Vec3.
+func (a Atom) Pos() Vec3 { return Vec3{a.X, a.Y, a.Z} }
+
+// Is3D reports whether the molecule carries real Z coordinates.
+func (m *Molecule) Is3D() bool {
+	for _, a := range m.Atoms {
+		if a.Z != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ViewBasis 由观察方向 eye（从分子指向观察者）得到屏幕坐标系 u(右)、v(上)、n(朝向观察者)
+func ViewBasis(eye Vec3) (u, v, n Vec3) {
+	n = eye.Normalize()
+	if n.Norm() == 0 {
+		n = Vec3{0, 0, 1}
+	}
+	up := Vec3{0, 1, 0}
+	if math.Abs(n.Dot(up)) > 0.999 {
+		up = Vec3{1, 0, 0}
+	}
+	u = up.Cross(n).Normalize()
+	v = n.Cross(u)
+	return
+}
+
+// ProjectTo2D returns a copy of m viewed from direction eye (pointing from the
+// molecule towards the viewer) with X/Y set to screen coordinates and Z to depth.
+// eye = (0,0,1) keeps the stored X/Y unchanged, so 3D records can go straight to the renderer.
+func (m *Molecule) ProjectTo2D(eye Vec3) *Molecule {
+	u, v, n := ViewBasis(eye)
+	c := m.Copy()
+	for i := range c.Atoms {
+		p := m.Atoms[i].Pos()
+		c.Atoms[i].X = p.Dot(u)
+		c.Atoms[i].Y = p.Dot(v)
+		c.Atoms[i].Z = p.Dot(n)
+	}
+	return c
+}
+
+// FlattestView 3D 构象最扁的方向（坐标协方差最小特征值的特征向量），沿它投影时原子在屏幕上铺得最开、
+// 重叠最少，作为 ProjectTo2D 的默认观察方向。2D 记录返回 (0,0,1)
+func (m *Molecule) FlattestView() Vec3 {
+	if !m.Is3D() || len(m.Atoms) < 3 {
+		return Vec3{0, 0, 1}
+	}
+	var c Vec3
+	for _, a := range m.Atoms {
+		c = Vec3{c.X + a.X, c.Y + a.Y, c.Z + a.Z}
+	}
+	n := float64(len(m.Atoms))
+	c = Vec3{c.X / n, c.Y / n, c.Z / n}
+	var cov [3][3]float64
+	for _, a := range m.Atoms {
+		d := a.Pos().Sub(c)
+		p := [3]float64{d.X, d.Y, d.Z}
+		for i := 0; i < 3; i++ {
+			for j := 0; j < 3; j++ {
+				cov[i][j] += p[i] * p[j]
+			}
+		}
+	}
+	vals, vecs := jacobiEigen3(cov)
+	k := 0
+	for i := 1; i < 3; i++ {
+		if vals[i] < vals[k] {
+			k = i
+		}
+	}
+	return Vec3{vecs[0][k], vecs[1][k], vecs[2][k]}
+}
+
+// jacobiEigen3 对称 3x3 矩阵的特征分解（Jacobi 旋转），特征向量为返回矩阵的列
+func jacobiEigen3(a [3][3]float64) ([3]float64, [3][3]float64) {
+	v := [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+	for sweep := 0; sweep < 50; sweep++ {
+		off := a[0][1]*a[0][1] + a[0][2]*a[0][2] + a[1][2]*a[1][2]
+		if off < 1e-20 {
+			break
+		}
+		for p := 0; p < 2; p++ {
+			for q := p + 1; q < 3; q++ {
+				if math.Abs(a[p][q]) < 1e-30 {
+					continue
+				}
+				theta := (a[q][q] - a[p][p]) / (2 * a[p][q])
+				t := math.Copysign(1, theta) / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+				c := 1 / math.Sqrt(t*t+1)
+				s := t * c
+				for k := 0; k < 3; k++ {
+					akp, akq := a[k][p], a[k][q]
+					a[k][p], a[k][q] = c*akp-s*akq, s*akp+c*akq
+				}
+				for k := 0; k < 3; k++ {
+					apk, aqk := a[p][k], a[q][k]
+					a[p][k], a[q][k] = c*apk-s*aqk, s*apk+c*aqk
+				}
+				for k := 0; k < 3; k++ {
+					vkp, vkq := v[k][p], v[k][q]
+					v[k][p], v[k][q] = c*vkp-s*vkq, s*vkp+c*vkq
+				}
+			}
+		}
+	}
+	return [3]float64{a[0][0], a[1][1], a[2][2]}, v
+}
+
+// ParseViewDirection 解析 "x,y,z" 形式的观察方向（从分子指向观察者），不能为零向量
+func ParseViewDirection(s string) (Vec3, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 3 {
+		return Vec3{}, fmt.Errorf("invalid view direction %q (want x,y,z)", s)
+	}
+	var xyz [3]float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return Vec3{}, fmt.Errorf("invalid view direction %q (want x,y,z)", s)
+		}
+		xyz[i] = f
+	}
+	v := Vec3{xyz[0], xyz[1], xyz[2]}
+	if v.Norm() == 0 {
+		return Vec3{}, fmt.Errorf("view direction must not be zero")
+	}
+	return v, nil
+}
+
+// chiralVolumeEps 小于该有向体积视为平面，无法判定手性
+const chiralVolumeEps = 1e-4
+
+// TetrahedralSign3D derives handedness of centre c0 from 3D coordinates.
+// nbrs 为按优先级从高到低排列的邻居（0-based），可以是 3 个（第 4 个为隐式 H）或 4 个。
+// 以最后一个邻居背向观察者观看，其余邻居顺时针排列返回 +1（对应 CIP 的 R），
+// 逆时针返回 -1（S），几何退化返回 0。
+func (m *Molecule) TetrahedralSign3D(c0 int, nbrs []int) int {
+	if len(nbrs) != 3 && len(nbrs) != 4 {
+		return 0
+	}
+	// 隐式 H 近似位于中心原子处：与其余三个邻居构成的体积同号
+	d := m.Atoms[c0].Pos()
+	if len(nbrs) == 4 {
+		d = m.Atoms[nbrs[3]].Pos()
+	}
+	return TetrahedralSign(m.Atoms[nbrs[0]].Pos(), m.Atoms[nbrs[1]].Pos(), m.Atoms[nbrs[2]].Pos(), d)
+}
+
+// TetrahedralSign 同 TetrahedralSign3D，直接给出按优先级从高到低的四个邻居位置
+func TetrahedralSign(p0, p1, p2, p3 Vec3) int {
+	a := p0.Sub(p3)
+	b := p1.Sub(p3)
+	c := p2.Sub(p3)
+	vol := a.Dot(b.Cross(c))
+	switch {
+	case vol < -chiralVolumeEps:
+		return 1
+	case vol > chiralVolumeEps:
+		return -1
+	}
+	return 0
+}
@@ -0,0 +1,341 @@
+// File: store.go
+package main
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrChallengeNotFound 题目不存在、已过期或已验证过
+var ErrChallengeNotFound = errors.New("challenge not found or expired")
+
+// ErrStoreFull 存储已满且不能淘汰旧记录（重放缓存），调用方应返回 503
+var ErrStoreFull = errors.New("challenge store full")
+
+// ChallengeStore 题目存储后端。Put 返回过期时间，c.Expires 非零时沿用（答错后放回的题目）；Get 只读，供图片、切片、管理接口使用；
+// Consume 取出即删除，保证每道题只能验证一次；Sweep 清理 now 之前过期的题目并返回删除个数。
+// 找不到或已过期时 Get/Consume 返回 ErrChallengeNotFound，其余错误为存储故障
+type ChallengeStore interface {
+	Put(id string, c Challenge) (time.Time, error)
+	Get(id string) (Challenge, error)
+	Consume(id string) (Challenge, error)
+	Sweep(now time.Time) (int, error)
+}
+
+// ChallengeIssuer 自己生成题目 ID 的无状态存储（见 sealed.go）：题目封装在 ID 里，
+// 服务端不保存分子和图片，整图重绘、切片模式和管理接口都不可用
+type ChallengeIssuer interface {
+	Issue(c Challenge) (id string, expires time.Time, err error)
+}
+
+// 存储后端
+const (
+	StoreMemory = "memory" // 进程内分片存储，重启即丢失
+	StoreFile   = "file"   // 目录中每题一个文件，可重启恢复、多实例共享（见 filestore.go）
+	StoreSealed = "sealed" // 无状态：答案加密封装在题目 ID 中（见 sealed.go）
+)
+
+// 题目存储设置，main 中可由环境变量 CHIRAL_CHALLENGE_TTL、CHIRAL_MAX_CHALLENGES、
+// CHIRAL_STORE、CHIRAL_STORE_DIR、CHIRAL_SEAL_KEY 覆盖
+var (
+	ChallengeTTL  = 5 * time.Minute  // 题目有效期
+	MaxChallenges = 10000            // 同时保存的题目上限，满了淘汰最先过期的；文件存储在后台清理时执行
+	MaxAttempts   = 1                // 每道题最多验证几次，答错未用完时放回存储
+	SweepInterval = 30 * time.Second // 后台清理过期题目的间隔
+	StoreShards   = 16               // 内存存储的分片数
+
+	challenges ChallengeStore = NewMemoryStore(ChallengeTTL, MaxChallenges, StoreShards)
+)
+
+// OpenChallengeStore 按名称创建存储后端，dir 只对 StoreFile 有效，key 只对 StoreSealed 有效
+func OpenChallengeStore(kind, dir, key string) (ChallengeStore, error) {
+	switch kind {
+	case "", StoreMemory:
+		return NewMemoryStore(ChallengeTTL, MaxChallenges, StoreShards), nil
+	case StoreFile:
+		return NewFileStore(dir, ChallengeTTL, MaxChallenges)
+	case StoreSealed:
+		return NewSealedStore(key, ChallengeTTL, MaxChallenges)
+	}
+	return nil, fmt.Errorf("unknown challenge store %q (available: %s, %s, %s)", kind, StoreMemory, StoreFile, StoreSealed)
+}
+
+// statelessStore reports whether the current store keeps no challenge data server-side.
+func statelessStore() bool {
+	_, ok := challenges.(ChallengeIssuer)
+	return ok
+}
+
+// RunSweeper 每隔 interval 清理一次过期题目，不返回；在 main 中用 go 启动
+func RunSweeper(s ChallengeStore, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for now := range t.C {
+		n, err := s.Sweep(now)
+		if err != nil {
+			log.Printf("sweep challenges: %v", err)
+		}
+		if n > 0 {
+			log.Printf("swept %d expired challenges", n)
+		}
+	}
+}
+
+// MemoryStore 进程内存储：按 ID 哈希分成若干片，各片一把锁，减少并发请求间的锁竞争。
+// 容量上限对整个存储生效：超出时比较各片最先过期的题目，淘汰全局最先过期的一道
+type MemoryStore struct {
+	shards []*memoryShard
+	max    int
+	count  atomic.Int64  // 所有分片中的题目数，含尚未清理的过期题目
+	seq    atomic.Uint64 // 存入顺序，过期时间相同时比较先后用
+}
+
+// NewMemoryStore returns an in-memory store holding at most max challenges (0 = unlimited).
+func NewMemoryStore(ttl time.Duration, max, shards int) *MemoryStore {
+	if shards < 1 {
+		shards = 1
+	}
+	s := &MemoryStore{shards: make([]*memoryShard, shards), max: max}
+	for i := range s.shards {
+		s.shards[i] = newMemoryShard(s, ttl)
+	}
+	return s
+}
+
+func (s *MemoryStore) shard(id string) *memoryShard {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return s.shards[h.Sum32()%uint32(len(s.shards))]
+}
+
+func (s *MemoryStore) Put(id string, c Challenge) (time.Time, error) {
+	expires := s.shard(id).Put(id, c)
+	s.enforceMax()
+	return expires, nil
+}
+
+// PutNew stores c only if id is absent or expired and reports whether it did.
+// 检查与写入在同一把锁内完成，用作一次性令牌的重放缓存。重放缓存淘汰记录就等于允许重放，
+// 所以 PutNew 从不淘汰：满了先清理过期记录，仍然满则返回 ErrStoreFull。
+// 并发写入时可能略微超出上限
+func (s *MemoryStore) PutNew(id string, c Challenge) (bool, error) {
+	sh := s.shard(id)
+	if _, ok := sh.Get(id); ok {
+		return false, nil
+	}
+	if s.max > 0 && s.count.Load() >= int64(s.max) {
+		s.Sweep(time.Now())
+		if s.count.Load() >= int64(s.max) {
+			return false, ErrStoreFull
+		}
+	}
+	return sh.PutNew(id, c), nil
+}
+
+// enforceMax 超出上限时逐个淘汰全局最先过期的题目（TTL 相同时就是最早存入的）。写入时已释放分片锁，
+// 这里每次只锁一片，不会与其他写入互相等待；并发写入时可能短暂超出上限
+func (s *MemoryStore) enforceMax() {
+	for s.max > 0 && s.count.Load() > int64(s.max) {
+		var oldest *memoryShard
+		var oldestItem *storedChallenge
+		for _, sh := range s.shards {
+			if it, ok := sh.front(); ok && (oldest == nil || it.before(oldestItem)) {
+				oldest, oldestItem = sh, it
+			}
+		}
+		if oldest == nil || !oldest.evictFront() {
+			return
+		}
+	}
+}
+
+func (s *MemoryStore) Get(id string) (Challenge, error) {
+	if c, ok := s.shard(id).Get(id); ok {
+		return c, nil
+	}
+	return Challenge{}, ErrChallengeNotFound
+}
+
+func (s *MemoryStore) Consume(id string) (Challenge, error) {
+	if c, ok := s.shard(id).Consume(id); ok {
+		return c, nil
+	}
+	return Challenge{}, ErrChallengeNotFound
+}
+
+func (s *MemoryStore) Sweep(now time.Time) (int, error) {
+	n := 0
+	for _, sh := range s.shards {
+		n += sh.Sweep(now)
+	}
+	return n, nil
+}
+
+// Len returns the number of stored challenges, expired ones included until swept.
+func (s *MemoryStore) Len() int {
+	n := 0
+	for _, sh := range s.shards {
+		n += sh.Len()
+	}
+	return n
+}
+
+// storedChallenge 存储中的一道题，elem 指向 order 中的位置，seq 为全局存入顺序
+type storedChallenge struct {
+	id      string
+	chal    Challenge
+	expires time.Time
+	seq     uint64
+	elem    *list.Element
+}
+
+// before 按过期时间、再按存入顺序比较
+func (it *storedChallenge) before(o *storedChallenge) bool {
+	if !it.expires.Equal(o.expires) {
+		return it.expires.Before(o.expires)
+	}
+	return it.seq < o.seq
+}
+
+// memoryShard 带有效期的一片存储：过期的题目读不到，由 Sweep 定期清理；
+// 存满时由 MemoryStore 淘汰最先过期的题目；验证时 Consume 取出即删除
+type memoryShard struct {
+	mu    sync.Mutex
+	store *MemoryStore // 维护全局计数和存入顺序
+	ttl   time.Duration
+	items map[string]*storedChallenge
+	// order 按过期先后排列的 *storedChallenge。新题目的过期时间通常最晚，从尾部往前找插入位置；
+	// 答错放回的题目和重放缓存里的令牌沿用原来的过期时间，会插到中间
+	order *list.List
+}
+
+func newMemoryShard(store *MemoryStore, ttl time.Duration) *memoryShard {
+	return &memoryShard{store: store, ttl: ttl, items: make(map[string]*storedChallenge), order: list.New()}
+}
+
+// Put stores c under id and returns its expiry time.
+func (s *memoryShard) Put(id string, c Challenge) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.putLocked(id, c)
+}
+
+// PutNew stores c only if id is absent or expired.
+func (s *memoryShard) PutNew(id string, c Challenge) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if it, ok := s.items[id]; ok && !time.Now().After(it.expires) {
+		return false
+	}
+	s.putLocked(id, c)
+	return true
+}
+
+func (s *memoryShard) putLocked(id string, c Challenge) time.Time {
+	if old, ok := s.items[id]; ok {
+		s.removeLocked(id, old)
+	}
+	if c.Expires.IsZero() {
+		c.Expires = time.Now().Add(s.ttl)
+	}
+	it := &storedChallenge{id: id, chal: c, expires: c.Expires, seq: s.store.seq.Add(1)}
+	e := s.order.Back()
+	for e != nil && it.before(e.Value.(*storedChallenge)) {
+		e = e.Prev()
+	}
+	if e == nil {
+		it.elem = s.order.PushFront(it)
+	} else {
+		it.elem = s.order.InsertAfter(it, e)
+	}
+	s.items[id] = it
+	s.store.count.Add(1)
+	return c.Expires
+}
+
+func (s *memoryShard) removeLocked(id string, it *storedChallenge) {
+	s.order.Remove(it.elem)
+	delete(s.items, id)
+	s.store.count.Add(-1)
+}
+
+// front returns the challenge in the shard that expires first.
+// 返回的条目只用于比较过期时间和存入顺序，这两个字段写入后不再修改
+func (s *memoryShard) front() (*storedChallenge, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	front := s.order.Front()
+	if front == nil {
+		return nil, false
+	}
+	return front.Value.(*storedChallenge), true
+}
+
+// evictFront removes the challenge in the shard that expires first.
+func (s *memoryShard) evictFront() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	front := s.order.Front()
+	if front == nil {
+		return false
+	}
+	it := front.Value.(*storedChallenge)
+	s.removeLocked(it.id, it)
+	return true
+}
+
+// Get returns the challenge without removing it.
+func (s *memoryShard) Get(id string) (Challenge, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	it, ok := s.items[id]
+	if !ok || time.Now().After(it.expires) {
+		return Challenge{}, false
+	}
+	return it.chal, true
+}
+
+// Consume removes and returns the challenge.
+func (s *memoryShard) Consume(id string) (Challenge, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	it, ok := s.items[id]
+	if !ok {
+		return Challenge{}, false
+	}
+	s.removeLocked(id, it)
+	if time.Now().After(it.expires) {
+		return Challenge{}, false
+	}
+	return it.chal, true
+}
+
+// Sweep 删除所有在 now 之前过期的题目，返回删除个数。order 按过期先后排列，
+// 遇到第一个未过期的即可停止
+func (s *memoryShard) Sweep(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for e := s.order.Front(); e != nil; e = s.order.Front() {
+		it := e.Value.(*storedChallenge)
+		if !now.After(it.expires) {
+			break
+		}
+		s.removeLocked(it.id, it)
+		n++
+	}
+	return n
+}
+
+// Len returns the number of challenges in the shard.
+func (s *memoryShard) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.items)
+}
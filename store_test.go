@@ -0,0 +1,159 @@
+// File: store_test.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreExpiry(t *testing.T) {
+	s := NewMemoryStore(time.Minute, 0, 4)
+	if _, err := s.Put("old", Challenge{Mode: ModeGrid, Expires: time.Now().Add(-time.Second)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get("old"); !errors.Is(err, ErrChallengeNotFound) {
+		t.Errorf("Get expired: err = %v, want ErrChallengeNotFound", err)
+	}
+	if _, err := s.Consume("old"); !errors.Is(err, ErrChallengeNotFound) {
+		t.Errorf("Consume expired: err = %v, want ErrChallengeNotFound", err)
+	}
+
+	expires, err := s.Put("new", Challenge{Mode: ModeGrid})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Until(expires); d <= 0 || d > time.Minute {
+		t.Errorf("expiry in %v, want within the TTL", d)
+	}
+	if _, err := s.Get("new"); err != nil {
+		t.Errorf("Get live: %v", err)
+	}
+}
+
+func TestMemoryStoreConsumeOnce(t *testing.T) {
+	s := NewMemoryStore(time.Minute, 0, 4)
+	s.Put("id", Challenge{Mode: ModeGrid, Answers: []string{"A1"}})
+	c, err := s.Consume("id")
+	if err != nil || len(c.Answers) != 1 || c.Answers[0] != "A1" {
+		t.Fatalf("first Consume = %+v, %v", c, err)
+	}
+	if _, err := s.Consume("id"); !errors.Is(err, ErrChallengeNotFound) {
+		t.Errorf("second Consume: err = %v, want ErrChallengeNotFound", err)
+	}
+	if _, err := s.Get("id"); !errors.Is(err, ErrChallengeNotFound) {
+		t.Errorf("Get after Consume: err = %v, want ErrChallengeNotFound", err)
+	}
+}
+
+func TestMemoryStoreEvictsOldest(t *testing.T) {
+	s := NewMemoryStore(time.Minute, 3, 1)
+	for i := 0; i < 5; i++ {
+		s.Put(fmt.Sprint(i), Challenge{Mode: ModeGrid})
+	}
+	if n := s.Len(); n != 3 {
+		t.Fatalf("Len = %d, want 3", n)
+	}
+	for i := 0; i < 5; i++ {
+		_, err := s.Get(fmt.Sprint(i))
+		if evicted := i < 2; evicted != errors.Is(err, ErrChallengeNotFound) {
+			t.Errorf("challenge %d: err = %v, evicted = %v", i, err, evicted)
+		}
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	s := NewMemoryStore(time.Minute, 0, 2)
+	s.Put("a", Challenge{Expires: time.Now().Add(-time.Second)})
+	s.Put("b", Challenge{})
+	n, err := s.Sweep(time.Now())
+	if err != nil || n != 1 {
+		t.Fatalf("Sweep = %d, %v, want 1", n, err)
+	}
+	if s.Len() != 1 {
+		t.Errorf("Len = %d after sweep, want 1", s.Len())
+	}
+}
+
+func TestMemoryStoreCapIsGlobal(t *testing.T) {
+	// 上限小于分片数时也不能超出
+	s := NewMemoryStore(time.Minute, 5, 16)
+	for i := 0; i < 40; i++ {
+		s.Put(fmt.Sprint(i), Challenge{Mode: ModeGrid})
+		if n := s.Len(); n > 5 {
+			t.Fatalf("Len = %d after %d puts, want at most 5", n, i+1)
+		}
+	}
+	// 淘汰按全局存入顺序，留下的是最后 5 道
+	for i := 35; i < 40; i++ {
+		if _, err := s.Get(fmt.Sprint(i)); err != nil {
+			t.Errorf("challenge %d evicted: %v", i, err)
+		}
+	}
+
+	// 未满时不淘汰
+	s = NewMemoryStore(time.Minute, 100, 16)
+	for i := 0; i < 100; i++ {
+		s.Put(fmt.Sprint(i), Challenge{Mode: ModeGrid})
+	}
+	if n := s.Len(); n != 100 {
+		t.Errorf("Len = %d, want 100", n)
+	}
+}
+
+// 答错放回的题目沿用原来的过期时间，Sweep 和淘汰都要按过期时间而不是放回的先后
+func TestMemoryStorePutBackKeepsExpiryOrder(t *testing.T) {
+	t0 := time.Now()
+	s := NewMemoryStore(time.Minute, 0, 1)
+	s.Put("p", Challenge{Expires: t0.Add(time.Minute)})
+	s.Put("q", Challenge{Expires: t0.Add(2 * time.Minute)})
+	c, err := s.Consume("p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Attempts++
+	if expires, _ := s.Put("p", c); !expires.Equal(t0.Add(time.Minute)) {
+		t.Fatalf("put back expires %v, want the original expiry", expires)
+	}
+
+	n, _ := s.Sweep(t0.Add(90 * time.Second))
+	if n != 1 || s.Len() != 1 {
+		t.Fatalf("Sweep = %d, Len = %d, want 1, 1", n, s.Len())
+	}
+	if _, err := s.Get("q"); err != nil {
+		t.Errorf("unexpired challenge swept: %v", err)
+	}
+
+	// 满了淘汰最先过期的，而不是最早存入的
+	s = NewMemoryStore(time.Minute, 2, 4)
+	s.Put("late", Challenge{Expires: t0.Add(2 * time.Minute)})
+	s.Put("early", Challenge{Expires: t0.Add(time.Minute)})
+	s.Put("new", Challenge{Expires: t0.Add(3 * time.Minute)})
+	for id, kept := range map[string]bool{"late": true, "early": false, "new": true} {
+		if _, err := s.Get(id); (err == nil) != kept {
+			t.Errorf("%s: err = %v, want kept = %v", id, err, kept)
+		}
+	}
+}
+
+// 重放缓存里的令牌按各自的过期时间存入，先存入的不一定先过期；满了时要能清掉排在后面的过期令牌
+func TestMemoryStorePutNewSweepsOutOfOrderExpiry(t *testing.T) {
+	now := time.Now()
+	s := NewMemoryStore(time.Minute, 2, 1)
+	if ok, err := s.PutNew("late", Challenge{Expires: now.Add(time.Hour)}); !ok || err != nil {
+		t.Fatalf("PutNew late = %v, %v", ok, err)
+	}
+	if ok, err := s.PutNew("early", Challenge{Expires: now.Add(-time.Second)}); !ok || err != nil {
+		t.Fatalf("PutNew early = %v, %v", ok, err)
+	}
+	if ok, err := s.PutNew("new", Challenge{Expires: now.Add(time.Hour)}); !ok || err != nil {
+		t.Errorf("PutNew at cap with an expired nonce = %v, %v, want true, nil", ok, err)
+	}
+	if ok, err := s.PutNew("late", Challenge{Expires: now.Add(time.Hour)}); ok || err != nil {
+		t.Errorf("PutNew replay = %v, %v, want false, nil", ok, err)
+	}
+	if ok, err := s.PutNew("more", Challenge{Expires: now.Add(time.Hour)}); ok || !errors.Is(err, ErrStoreFull) {
+		t.Errorf("PutNew when full of live nonces = %v, %v, want ErrStoreFull", ok, err)
+	}
+}
@@ -0,0 +1,111 @@
+// File: theme.go
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Theme 渲染配色：背景、棋盘格、键线、手性标记及元素着色
+type Theme struct {
+	Name       string
+	Background string            // 画布底色
+	GridEven   string            // 棋盘格 (i+j) 为偶数的格子
+	GridOdd    string            // 棋盘格 (i+j) 为奇数的格子
+	GridLabel  string            // 格子编号文字
+	Bond       string            // 键线与默认原子标签
+	Marker     string            // 手性星号
+	AtomColors map[string]string // 元素标签颜色（CPK 风格），未列出的元素用 Bond
+}
+
+// AtomColor returns the label colour for element e.
+func (t *Theme) AtomColor(e string) string {
+	if c, ok := t.AtomColors[e]; ok {
+		return c
+	}
+	return t.Bond
+}
+
+// DefaultThemeName 未指定主题时使用，main 中可由环境变量 CHIRAL_THEME 覆盖
+var DefaultThemeName = "classic"
+
+// Themes 内置主题
+var Themes = map[string]*Theme{
+	// 原来的黑白配色
+	"classic": {
+		Name:       "classic",
+		Background: "#FFFFFF",
+		GridEven:   "#FFFFFF",
+		GridOdd:    "#E0E0E0",
+		GridLabel:  "#A0A0A0",
+		Bond:       "#000000",
+		Marker:     "#000000",
+	},
+	"cpk": {
+		Name:       "cpk",
+		Background: "#FFFFFF",
+		GridEven:   "#FFFFFF",
+		GridOdd:    "#E0E0E0",
+		GridLabel:  "#A0A0A0",
+		Bond:       "#000000",
+		Marker:     "#000000",
+		AtomColors: map[string]string{
+			"N": "#3050F8", "O": "#FF0D0D", "S": "#C8A000", "P": "#FF8000",
+			"F": "#1FA01F", "Cl": "#1FA01F", "Br": "#A62929", "I": "#940094",
+			"B": "#E07070", "Si": "#B09070",
+		},
+	},
+	"dark": {
+		Name:       "dark",
+		Background: "#121212",
+		GridEven:   "#1E1E1E",
+		GridOdd:    "#2C2C2C",
+		GridLabel:  "#7A7A7A",
+		Bond:       "#E8E8E8",
+		Marker:     "#FFD54F",
+		AtomColors: map[string]string{
+			"N": "#8FA8FF", "O": "#FF7070", "S": "#FFE066", "P": "#FFB060",
+			"F": "#7CDB7C", "Cl": "#7CDB7C", "Br": "#E08080", "I": "#D080D0",
+		},
+	},
+	"high-contrast": {
+		Name:       "high-contrast",
+		Background: "#FFFFFF",
+		GridEven:   "#FFFFFF",
+		GridOdd:    "#BDBDBD",
+		GridLabel:  "#000000",
+		Bond:       "#000000",
+		Marker:     "#C00000",
+	},
+	// Okabe–Ito 色盲友好调色板
+	"colorblind": {
+		Name:       "colorblind",
+		Background: "#FFFFFF",
+		GridEven:   "#FFFFFF",
+		GridOdd:    "#D6E6F4",
+		GridLabel:  "#5A5A5A",
+		Bond:       "#000000",
+		Marker:     "#D55E00",
+		AtomColors: map[string]string{
+			"N": "#0072B2", "O": "#D55E00", "S": "#E69F00", "P": "#CC79A7",
+			"F": "#009E73", "Cl": "#009E73", "Br": "#009E73", "I": "#009E73",
+		},
+	},
+}
+
+// LookupTheme returns the named theme; an empty name selects DefaultThemeName.
+func LookupTheme(name string) (*Theme, error) {
+	if name == "" {
+		name = DefaultThemeName
+	}
+	t, ok := Themes[name]
+	if !ok {
+		names := make([]string, 0, len(Themes))
+		for n := range Themes {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown theme %q (available: %v)", name, names)
+	}
+	return t, nil
+}
@@ -0,0 +1,71 @@
+// File: tiles.go
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"math/rand"
+
+	"github.com/google/uuid"
+)
+
+// CellRect 格子 (col, row) 的像素范围，与 drawGridBackground 的划分一致
+func CellRect(cfg *MoleculeRenderConfig, col, row int) image.Rectangle {
+	unitX := float64(cfg.Width) / float64(cfg.GridCountX)
+	unitY := float64(cfg.Height) / float64(cfg.GridCountY)
+	return image.Rect(
+		int(float64(col)*unitX), int(float64(row)*unitY),
+		int(float64(col+1)*unitX), int(float64(row+1)*unitY),
+	)
+}
+
+// CutTiles 把整张 PNG 按网格切开，每格单独编码为 PNG，顺序与 regions 一致（列优先）
+func CutTiles(pngBytes []byte, cfg *MoleculeRenderConfig) ([][]byte, error) {
+	img, err := png.Decode(bytes.NewReader(pngBytes))
+	if err != nil {
+		return nil, err
+	}
+	sub, ok := img.(interface {
+		SubImage(r image.Rectangle) image.Image
+	})
+	if !ok {
+		return nil, fmt.Errorf("image type %T cannot be cropped", img)
+	}
+	tiles := make([][]byte, 0, cfg.GridCountX*cfg.GridCountY)
+	for i := 0; i < cfg.GridCountX; i++ {
+		for j := 0; j < cfg.GridCountY; j++ {
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, sub.SubImage(CellRect(cfg, i, j))); err != nil {
+				return nil, err
+			}
+			tiles = append(tiles, buf.Bytes())
+		}
+	}
+	return tiles, nil
+}
+
+// TileSet 单个题目的切片。ID 随机生成、与位置无关，Order 为打乱后的展示顺序
+type TileSet struct {
+	Images map[string][]byte // 切片 ID → PNG
+	Order  []string          // 展示顺序
+	Cells  map[string]string // 格子标签 → 切片 ID
+}
+
+// NewTileSet 为 regions（与 tiles 一一对应）分配随机 ID 并打乱顺序
+func NewTileSet(tiles [][]byte, regions []string, rng *rand.Rand) *TileSet {
+	ts := &TileSet{
+		Images: make(map[string][]byte, len(tiles)),
+		Order:  make([]string, 0, len(tiles)),
+		Cells:  make(map[string]string, len(tiles)),
+	}
+	for k, b := range tiles {
+		id := uuid.New().String()
+		ts.Images[id] = b
+		ts.Order = append(ts.Order, id)
+		ts.Cells[regions[k]] = id
+	}
+	rng.Shuffle(len(ts.Order), func(a, b int) { ts.Order[a], ts.Order[b] = ts.Order[b], ts.Order[a] })
+	return ts
+}
@@ -0,0 +1,115 @@
+// File: transform.go
+package main
+
+import (
+	"math"
+	"math/rand"
+)
+
+// EnableAntiSolver 每个题目都对分子做随机变换，防止按 PubChem 坐标反查 CID；
+// main 中可用环境变量 CHIRAL_ANTISOLVER=0 关闭
+var EnableAntiSolver = true
+
+// ChallengeTransform 单个题目的随机变换参数。几何部分（旋转、镜像、抖动、扭曲）
+// 作用在分子坐标上，必须在计算答案格子之前 Apply；线宽与背景噪点在渲染时生效
+type ChallengeTransform struct {
+	Angle  float64 // 绕质心旋转角（弧度）
+	Mirror bool    // 先沿 Y 轴镜像（不改变哪些原子是手性中心）
+
+	Jitter    float64 // 每个原子坐标的随机扰动幅度，单位为平均键长
+	WarpAmp   float64 // 正弦扭曲幅度，单位为平均键长
+	WarpWave  float64 // 正弦扭曲波长，单位为平均键长
+	WarpPhase [2]float64
+
+	LineWidthScale float64 // 线宽倍数
+	NoiseDensity   float64 // 背景噪点密度：每 1000 平方像素的点数
+
+	rng *rand.Rand
+}
+
+// RandomTransform draws a new set of anti-solver parameters from rng.
+func RandomTransform(rng *rand.Rand) *ChallengeTransform {
+	return &ChallengeTransform{
+		Angle:          rng.Float64() * 2 * math.Pi,
+		Mirror:         rng.Intn(2) == 0,
+		Jitter:         0.04 + rng.Float64()*0.04,
+		WarpAmp:        0.05 + rng.Float64()*0.07,
+		WarpWave:       3 + rng.Float64()*3,
+		WarpPhase:      [2]float64{rng.Float64() * 2 * math.Pi, rng.Float64() * 2 * math.Pi},
+		LineWidthScale: 0.8 + rng.Float64()*0.6,
+		NoiseDensity:   0.3 + rng.Float64()*0.5,
+		rng:            rng,
+	}
+}
+
+// Apply returns a transformed copy of mol; atom and bond indices are unchanged.
+func (t *ChallengeTransform) Apply(mol *Molecule) *Molecule {
+	out := mol.Copy()
+	if len(out.Atoms) == 0 {
+		return out
+	}
+	bond := mol.AverageBondLength()
+	if bond == 0 {
+		bond = 1
+	}
+	var cx, cy float64
+	for _, a := range out.Atoms {
+		cx += a.X
+		cy += a.Y
+	}
+	cx /= float64(len(out.Atoms))
+	cy /= float64(len(out.Atoms))
+
+	sin, cos := math.Sincos(t.Angle)
+	wave := t.WarpWave * bond
+	for i := range out.Atoms {
+		a := &out.Atoms[i]
+		x, y := a.X-cx, a.Y-cy
+		if t.Mirror {
+			x = -x
+		}
+		x, y = x*cos-y*sin, x*sin+y*cos
+		// 平滑扭曲：相邻原子位移接近，整体形状仍可辨认
+		if wave > 0 {
+			x += t.WarpAmp * bond * math.Sin(2*math.Pi*y/wave+t.WarpPhase[0])
+			y += t.WarpAmp * bond * math.Sin(2*math.Pi*x/wave+t.WarpPhase[1])
+		}
+		// 键长抖动
+		if t.rng != nil && t.Jitter > 0 {
+			x += t.rng.NormFloat64() * t.Jitter * bond
+			y += t.rng.NormFloat64() * t.Jitter * bond
+		}
+		a.X, a.Y = x, y
+	}
+	return out
+}
+
+// Configure copies the render-time parameters into cfg.
+func (t *ChallengeTransform) Configure(cfg *MoleculeRenderConfig) {
+	cfg.LineWidthScale = t.LineWidthScale
+	cfg.NoiseDensity = t.NoiseDensity
+}
+
+// drawNoise 在背景上撒随机小点和短线，颜色取棋盘格/编号色，不遮挡分子
+func drawNoise(dc Renderer, cfg *MoleculeRenderConfig) {
+	if cfg.NoiseDensity <= 0 {
+		return
+	}
+	n := int(cfg.NoiseDensity * float64(cfg.Width*cfg.Height) / 1000)
+	colors := []string{cfg.Theme.GridEven, cfg.Theme.GridOdd, cfg.Theme.GridLabel}
+	dc.SetLineWidth(math.Max(1, cfg.FontSize/24))
+	for i := 0; i < n; i++ {
+		x := rand.Float64() * float64(cfg.Width)
+		y := rand.Float64() * float64(cfg.Height)
+		dc.SetHexColor(colors[rand.Intn(len(colors))])
+		if rand.Intn(3) == 0 {
+			l := cfg.FontSize * (0.2 + rand.Float64()*0.4)
+			ang := rand.Float64() * 2 * math.Pi
+			dc.DrawLine(x, y, x+l*math.Cos(ang), y+l*math.Sin(ang))
+			dc.Stroke()
+		} else {
+			dc.DrawCircle(x, y, cfg.FontSize/30+rand.Float64()*cfg.FontSize/20)
+			dc.Fill()
+		}
+	}
+}
@@ -1,27 +1,46 @@
 // File: types.go
 package main
 
-// Challenge holds data for a captcha challenge
-type Challenge struct {
-	Regions []string // 所有可选区域，比如 ["A1","A2",...]
-	Answers []string // 正确答案区域列表
+import "time"
+
+// 点结构体，用于裁剪线段端点，也用作点击坐标（图片像素）
+type Point struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
 }
 
 // StartResponse is returned by /api/challenge/start
 type StartResponse struct {
-	UUID    string   `json:"uuid"`
-	Image   string   `json:"image"`   // Base64 PNG
-	Regions []string `json:"regions"` // 全部可选区域
+	UUID      string            `json:"uuid"`
+	ExpiresAt time.Time         `json:"expires_at"` // 题目过期时间，过期或验证一次后失效
+	Mode      string            `json:"mode"`       // grid、click、tiles、rs 或 3d
+	Image     string            `json:"image"`      // data URI，Base64 PNG 或 SVG
+	Scale     int               `json:"scale"`      // image 的像素倍率
+	Width     int               `json:"width"`      // 1x 图片尺寸，点击坐标以此为准
+	Height    int               `json:"height"`
+	Regions   []string          `json:"regions"`            // 全部可选区域（点击模式为空）
+	Layout    *GridLayout       `json:"layout,omitempty"`   // 网格布局，前端按此排列选项
+	Tiles     []string          `json:"tiles,omitempty"`    // 切片模式：打乱顺序的切片图片 URL，与 regions 一一对应
+	Variants  map[string]string `json:"variants,omitempty"` // 1x/2x/3x 图片 URL（切片模式没有）
+}
+
+// GridLayout describes the grid drawn on the image
+type GridLayout struct {
+	Cols   int        `json:"cols"`
+	Rows   int        `json:"rows"`
+	Labels [][]string `json:"labels"` // labels[row][col]
 }
 
 // VerifyRequest is the JSON body for /api/challenge/verify
 type VerifyRequest struct {
 	UUID       string   `json:"uuid"`
 	Selections []string `json:"selections"`
+	Clicks     []Point  `json:"clicks"` // 点击模式：图片像素坐标
 }
 
 // VerifyResponse is returned by /api/challenge/verify
 type VerifyResponse struct {
-	Success bool   `json:"success"`
-	Message string `json:"message"`
+	Success      bool   `json:"success"`
+	Message      string `json:"message"`
+	AttemptsLeft int    `json:"attempts_left"` // 答错后本题剩余的验证次数，0 表示需要重新获取题目
 }
@@ -9,3 +9,16 @@ func AutoGrid(n int) (cols, rows int) {
 	rows = int(math.Ceil(float64(n) / float64(cols)))
 	return
 }
+
+// AutoGridAspect is AutoGrid with a target cols/rows ratio
+func AutoGridAspect(n int, aspect float64) (cols, rows int) {
+	if n < 1 {
+		n = 1
+	}
+	cols = int(math.Ceil(math.Sqrt(float64(n) * aspect)))
+	if cols < 1 {
+		cols = 1
+	}
+	rows = int(math.Ceil(float64(n) / float64(cols)))
+	return
+}
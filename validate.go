@@ -0,0 +1,196 @@
+// File: validate.go
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// PubChem SD 数据项中与立体中心计数相关的标签
+const (
+	tagCompoundCID    = "PUBCHEM_COMPOUND_CID"
+	tagDefStereoCount = "PUBCHEM_ATOM_DEF_STEREO_COUNT"
+	tagUdefStereoCnt  = "PUBCHEM_ATOM_UDEF_STEREO_COUNT"
+)
+
+// ValidateStats 汇总一次校验的结果
+type ValidateStats struct {
+	Total     int // 读到的分子记录数
+	Checked   int // 带有立体计数标签、实际参与比较的记录数
+	Mismatch  int // 计数不一致的记录数
+	Hetero    int // PubChem 多出的立体中心可由 N/P/S 立体中心解释的记录数（不计入 Mismatch）
+	ParseFail int // mol 块解析失败的记录数
+}
+
+// ParseSDFProperties 解析一条 SDF 记录 "M  END" 之后的数据项（> <TAG> 与随后的值行）
+func ParseSDFProperties(str string) map[string]string {
+	props := make(map[string]string)
+	lines := strings.Split(strings.ReplaceAll(str, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if !strings.HasPrefix(line, ">") {
+			continue
+		}
+		start := strings.Index(line, "<")
+		end := strings.LastIndex(line, ">")
+		if start < 0 || end <= start {
+			continue
+		}
+		tag := line[start+1 : end]
+		// 值可能有多行，直到空行为止
+		var vals []string
+		for i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != "" {
+			i++
+			vals = append(vals, strings.TrimRight(lines[i], " "))
+		}
+		props[tag] = strings.Join(vals, "\n")
+	}
+	return props
+}
+
+// ValidateStereoCounts 流式读取 SDF 文件，把 GetMoleculeChiralCarbons 的结果与
+// PUBCHEM_ATOM_DEF_STEREO_COUNT + PUBCHEM_ATOM_UDEF_STEREO_COUNT 对比，
+// 不一致的记录按 "CID\texpected\tactual\tatoms\thetero" 写入 reportPath。
+// PubChem 的计数包括 N、P、S 立体中心，而 chiral.go 只识别碳，hetero 列出分子中的杂原子立体中心；
+// 只有 PubChem 比 chiral.go 多、且多出的个数不超过杂原子立体中心数时记为 Hetero，其余都是 Mismatch。
+// 报告写入或关闭失败时返回错误
+func ValidateStereoCounts(sdfPath, reportPath string) (*ValidateStats, error) {
+	inFile, err := os.Open(sdfPath)
+	if err != nil {
+		return nil, err
+	}
+	defer inFile.Close()
+
+	outFile, err := os.Create(reportPath)
+	if err != nil {
+		return nil, err
+	}
+	writer := bufio.NewWriter(outFile)
+	stats, err := validateStream(inFile, writer)
+	// bufio.Writer 的写错误会保留到 Flush 返回
+	if ferr := writer.Flush(); err == nil {
+		err = ferr
+	}
+	if cerr := outFile.Close(); err == nil {
+		err = cerr
+	}
+	return stats, err
+}
+
+// validateStream 逐条校验 in 中的记录，报告写入 w
+func validateStream(in io.Reader, w io.Writer) (*ValidateStats, error) {
+	fmt.Fprintln(w, "cid\texpected\tactual\tatoms\thetero")
+
+	stats := &ValidateStats{}
+	reader := bufio.NewReader(in)
+	var molBuf strings.Builder
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return stats, err
+		}
+		if strings.TrimRight(line, "\r\n") == "$$$$" {
+			validateRecord(molBuf.String(), w, stats)
+			molBuf.Reset()
+		} else {
+			molBuf.WriteString(line)
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	// 文件最后没以 $$$$ 结尾
+	if strings.TrimSpace(molBuf.String()) != "" {
+		validateRecord(molBuf.String(), w, stats)
+	}
+	return stats, nil
+}
+
+// validateRecord 校验单条记录，不一致时写一行报告
+func validateRecord(molStr string, w io.Writer, stats *ValidateStats) {
+	stats.Total++
+	props := ParseSDFProperties(molStr)
+	def, errDef := strconv.Atoi(strings.TrimSpace(props[tagDefStereoCount]))
+	udef, errUdef := strconv.Atoi(strings.TrimSpace(props[tagUdefStereoCnt]))
+	if errDef != nil || errUdef != nil {
+		return // 没有参考答案，跳过
+	}
+	mol, err := ParseMolString(molStr)
+	if err != nil {
+		stats.ParseFail++
+		return
+	}
+	stats.Checked++
+
+	chiral := GetMoleculeChiralCarbons(mol)
+	expected := def + udef
+	if len(chiral) == expected {
+		return
+	}
+	// 漏掉的杂原子立体中心只能让 PubChem 的计数偏多
+	hetero := heteroStereoCentres(mol)
+	if missing := expected - len(chiral); missing > 0 && missing <= len(hetero) {
+		stats.Hetero++
+	} else {
+		stats.Mismatch++
+	}
+
+	cid := strings.TrimSpace(props[tagCompoundCID])
+	fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\n", cid, expected, len(chiral), joinInts(chiral), joinInts(hetero))
+}
+
+// heteroStereoCentres 构型稳定、可能成为立体中心的杂原子（1-based）：季铵 N+、四配位 P(V) 与鏻盐 P+、
+// 亚砜 S（S=O 或 S+-O-）和锍盐 S+。叔胺、酰胺 N 会快速翻转，不算。
+// 不比较取代基是否互不相同，只用来判断 PubChem 多出的计数能否由杂原子解释
+func heteroStereoCentres(mol *Molecule) []int {
+	heavy := make([]int, len(mol.Atoms))  // 非氢邻居数
+	single := make([]int, len(mol.Atoms)) // 非氢单键数
+	double := make([]int, len(mol.Atoms)) // 双键数
+	for _, b := range mol.Bonds {
+		for _, end := range [2][2]int{{b.From, b.To}, {b.To, b.From}} {
+			if mol.Atoms[end[1]].Element == "H" {
+				continue
+			}
+			heavy[end[0]]++
+			switch b.Order {
+			case 1:
+				single[end[0]]++
+			case 2:
+				double[end[0]]++
+			}
+		}
+	}
+	var out []int
+	for i, a := range mol.Atoms {
+		stereo := false
+		switch a.Element {
+		case "N":
+			stereo = a.Charge == 1 && single[i] == 4
+		case "P":
+			stereo = heavy[i] == 4 && (single[i]+2*double[i] == 5 || a.Charge == 1 && single[i] == 4)
+		case "S":
+			switch {
+			case a.Charge == 0:
+				stereo = heavy[i] == 3 && single[i] == 2 && double[i] == 1
+			case a.Charge == 1:
+				stereo = heavy[i] == 3 && single[i] == 3
+			}
+		}
+		if stereo {
+			out = append(out, i+1)
+		}
+	}
+	return out
+}
+
+func joinInts(xs []int) string {
+	parts := make([]string, len(xs))
+	for i, x := range xs {
+		parts[i] = strconv.Itoa(x)
+	}
+	return strings.Join(parts, ",")
+}